@@ -1,40 +1,209 @@
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"github.com/biodebox/go-coge-cli/internal"
 	"github.com/biodebox/go-coge-cli/internal/founder"
+	"go/ast"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+var (
+	typeNames = flag.String(`type`, ``, `comma-separated list of type names; default types marked with //coge:command, or the type after the go:generate line`)
+	output    = flag.String(`output`, ``, `output file name; default stdout`)
+	envPrefix = flag.String(`env-prefix`, ``, `prefix of environment variables derived from long option names, e.g. APP`)
+)
+
+const (
+	generatedSuffix  = `_cli_generated.go`
+	commandDirective = `//coge:command`
+)
+
+func usage() {
+	_, _ = fmt.Fprintf(os.Stderr, "Usage of coge-cli:\n")
+	_, _ = fmt.Fprintf(os.Stderr, "\tcoge-cli [flags] [-type T[,T...]] <file.go | directory>\n")
+	_, _ = fmt.Fprintf(os.Stderr, "\tcoge-cli [flags] [-type T[,T...]] # from go:generate\n")
+	_, _ = fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
-	f, err := founder.NewFounder(`C:\Users\recyg\go\src\github.com\biodebox\go-coge-sql\cmd\test\main.go`)
-	if err != nil {
-		log.Fatal(err)
+	log.SetFlags(0)
+	log.SetPrefix(`coge-cli: `)
+	flag.Usage = usage
+	flag.Parse()
+	names := splitNames(*typeNames)
+	var err error
+	switch goFile := os.Getenv(`GOFILE`); {
+	case flag.NArg() == 1:
+		err = run(flag.Arg(0), names, *output, *envPrefix)
+	case flag.NArg() == 0 && len(goFile) > 0:
+		err = runGenerate(goFile, os.Getenv(`GOPACKAGE`), os.Getenv(`GOLINE`), names, *output, *envPrefix)
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
-	file, err := os.OpenFile(`C:\Users\recyg\go\src\github.com\biodebox\go-coge-sql\cmd\test\main_generated.go`, os.O_RDWR | os.O_CREATE | os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
+}
 
+func runGenerate(goFile, goPackage, goLine string, names []string, outputName, prefix string) error {
+	f, err := founder.NewLoadedFounder(`.`, goPackage)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		// only the types marked in $GOFILE, other files have their own go:generate lines
+		directives, err := f.GetTypesByDirective(commandDirective)
+		if err != nil {
+			return err
+		}
+		for _, directive := range directives {
+			if filepath.Base(f.GetFileSet().Position(directive.Type.Pos()).Filename) == filepath.Base(goFile) {
+				names = append(names, directive.Type.Name.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		line, err := strconv.Atoi(goLine)
+		if err != nil {
+			return fmt.Errorf(`wrong GOLINE '%s': %s`, goLine, err)
 		}
-	}()
-	types, err := f.GetTypes(`Command`)
+		t, err := f.GetTypeAfterLine(goFile, line)
+		if err != nil {
+			return err
+		}
+		names = []string{t.Name.Name}
+	}
+	if len(outputName) == 0 {
+		outputName = strings.TrimSuffix(goFile, `.go`) + generatedSuffix
+	}
+	return generate(f, names, outputName, prefix)
+}
+
+func run(path string, names []string, outputName, prefix string) error {
+	f, err := founder.NewLoadedFounder(path, ``)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	commands, err := internal.ParseCommands(f.GetPackage(), types)
+	return generate(f, names, outputName, prefix)
+}
+
+func generate(f founder.Founder, names []string, outputName, prefix string) error {
+	directives, err := f.GetTypesByDirective(commandDirective)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	var types []*ast.TypeSpec
+	if len(names) == 0 {
+		for _, directive := range directives {
+			types = append(types, directive.Type)
+		}
+		if len(types) == 0 {
+			return fmt.Errorf(`no types given with -type or marked with %s`, commandDirective)
+		}
+	} else {
+		if types, err = f.GetTypes(names...); err != nil {
+			return err
+		}
+		if err := checkTypes(types, names); err != nil {
+			return err
+		}
+	}
+	commands, err := internal.ParseCommands(f.GetFileSet(), f.GetTypesInfo(), f.GetPackage(), types)
+	if err != nil {
+		return err
+	}
+	for linked := commands.Linked(); len(linked) > 0; linked = commands.Linked() {
+		types, err := f.GetPackageTypes(linked...)
+		if err != nil {
+			return err
+		}
+		if err := checkTypes(types, linked); err != nil {
+			return err
+		}
+		subcommands, err := internal.ParseCommands(f.GetFileSet(), f.GetTypesInfo(), f.GetPackage(), types)
+		if err != nil {
+			return err
+		}
+		commands = append(commands, subcommands...)
+	}
+	for _, directive := range directives {
+		for _, command := range commands {
+			if command.Name != directive.Type.Name.Name {
+				continue
+			}
+			if err := command.ParseDirective(directive.Args); err != nil {
+				return err
+			}
+		}
 	}
-	_= commands
 	for _, command := range commands {
-		command.Writer = file
-		command.FileSet = f.GetFileSet()
-		if err := internal.Generate(command); err != nil {
-			log.Fatalln(err)
+		methods, err := f.GetMethodsForStruct(command.Name, `Run`)
+		if err != nil {
+			return err
+		}
+		if err := command.ParseMethods(f.GetTypesInfo(), methods); err != nil {
+			return err
+		}
+	}
+	functions, err := f.GetFunctions()
+	if err != nil {
+		return err
+	}
+	if err := commands.ParseHandlers(f.GetFileSet(), f.GetTypesInfo(), functions); err != nil {
+		return err
+	}
+	commands.SetEnvPrefix(prefix)
+
+	var buffer bytes.Buffer
+	if err := internal.Generate(&buffer, commands, len(outputName) == 0); err != nil {
+		return err
+	}
+	if len(outputName) == 0 {
+		_, err = buffer.WriteTo(os.Stdout)
+		return err
+	}
+	var support bytes.Buffer
+	if err := internal.GenerateSupport(&support, f.GetPackage()); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(outputName, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(filepath.Dir(outputName), internal.SupportFileName), support.Bytes(), 0644)
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, `,`) {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func checkTypes(types []*ast.TypeSpec, names []string) error {
+	for _, name := range names {
+		found := false
+		for _, t := range types {
+			if t.Name.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(`type '%s' not found`, name)
 		}
 	}
+	return nil
 }
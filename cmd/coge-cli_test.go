@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerated generates the parser of testdata/app, builds the program and
+// runs it with the cases below.
+func TestGenerated(t *testing.T) {
+	if _, err := exec.LookPath(`go`); err != nil {
+		t.Skip(`go command isn't available`)
+	}
+	dir := copyFixture(t, filepath.Join(`testdata`, `app`))
+	output := filepath.Join(dir, `app_cli_generated.go`)
+	if err := run(dir, nil, output, `APP`); err != nil {
+		t.Fatal(err)
+	}
+	first, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := run(dir, nil, output, `APP`); err != nil {
+		t.Fatal(err)
+	}
+	second, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal(`generated output differs between runs`)
+	}
+	binary := filepath.Join(dir, `app`)
+	build := exec.Command(`go`, `build`, `-o`, binary, `.`)
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %s\n%s", err, out)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  []string
+		code int
+		want string
+	}{
+		{`run`, []string{`serve`, `--token`, `t`, `a`, `b`}, nil, 0, `serve port=8080 quiet=false token=t name= files=a,b`},
+		{`clustering`, []string{`serve`, `--token=t`, `-qp9`}, nil, 0, `serve port=9 quiet=true token=t`},
+		{`next value`, []string{`serve`, `--token`, `t`, `-p`, `7`}, nil, 0, `serve port=7`},
+		{`end of options`, []string{`serve`, `--token`, `t`, `--`, `-x`, `--y`}, nil, 0, `files=-x,--y`},
+		{`required`, []string{`serve`}, nil, 2, `missing required --token`},
+		{`choices`, []string{`serve`, `--token`, `t`, `--name`, `bad`}, nil, 2, `wrong value 'bad' for --name`},
+		{`env`, []string{`serve`}, []string{`APP_TOKEN=e`, `PORT=5`}, 0, `serve port=5 quiet=false token=e`},
+		{`flag over env`, []string{`serve`, `--token`, `t`, `--name`, `good`, `-p`, `6`}, []string{`APP_NAME=bad`, `PORT=x`}, 0, `serve port=6 quiet=false token=t name=good`},
+		{`wrong env`, []string{`serve`, `--token`, `t`}, []string{`PORT=x`}, 2, `environment variable PORT`},
+		{`subcommand`, []string{`-v`, `db`, `migrate`, `--dry-run`}, nil, 0, `migrate true`},
+		{`subcommand help`, []string{`db`, `-h`}, nil, 0, `Usage: tool db [options] [<command>]`},
+		{`no command`, nil, nil, 2, `Usage: tool [options] [<command>]`},
+		{`unknown option`, []string{`serve`, `--port-number`, `1`}, nil, 2, `--port-number`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command := exec.Command(binary, test.args...)
+			command.Env = append(os.Environ(), test.env...)
+			out, err := command.CombinedOutput()
+			code := 0
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.code || !strings.Contains(string(out), test.want) {
+				t.Errorf("exit code %d, output:\n%s\nwant exit code %d and %q", code, out, test.code, test.want)
+			}
+		})
+	}
+}
+
+func copyFixture(t *testing.T, src string) string {
+	dir, err := ioutil.TempDir(``, `coge-cli`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(src, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name()), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
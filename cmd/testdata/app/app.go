@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Tool runs the fixture commands.
+//coge:command name=tool
+type Tool struct {
+	Verbose bool   `cli:"type:option short:v"`
+	Serve   *Serve `cli:"command:serve"`
+	DB      *DB    `cli:"command:db"`
+}
+
+// Serve prints its options.
+type Serve struct {
+	Port  int      `cli:"type:option short:p default:8080 env:PORT"`
+	Quiet bool     `cli:"type:option short:q"`
+	Token string   `cli:"type:option required"`
+	Name  string   `cli:"type:option choices:'good|better'"`
+	Files []string `cli:"optional"`
+}
+
+func (s *Serve) Run(ctx context.Context) error {
+	fmt.Printf("serve port=%d quiet=%t token=%s name=%s files=%s\n", s.Port, s.Quiet, s.Token, s.Name, strings.Join(s.Files, `,`))
+	return nil
+}
+
+// DB works with the database.
+type DB struct {
+	Migrate *Migrate `cli:"command:migrate"`
+}
+
+type Migrate struct {
+	DryRun bool `cli:"type:option"`
+}
+
+//coge:handler
+func migrate(m *Migrate) error {
+	fmt.Println("migrate", m.DryRun)
+	return nil
+}
+
+func main() {
+	os.Exit(Main(os.Args[1:]))
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+func newString(value string) *ast.BasicLit {
+	if !strconv.CanBackquote(strings.Replace(value, "\n", ``, -1)) {
+		return &ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote(value),
+		}
+	}
+	return &ast.BasicLit{
+		Kind:  token.STRING,
+		Value: "`" + value + "`",
+	}
+}
+
+func newInt(value int) *ast.BasicLit {
+	return &ast.BasicLit{
+		Kind:  token.INT,
+		Value: strconv.Itoa(value),
+	}
+}
+
+func newIndex(name string, index int) *ast.IndexExpr {
+	return &ast.IndexExpr{
+		X:     ast.NewIdent(name),
+		Index: newInt(index),
+	}
+}
+
+func newLen(x ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:  ast.NewIdent(`len`),
+		Args: []ast.Expr{x},
+	}
+}
+
+func newBinary(x ast.Expr, op token.Token, y ast.Expr) *ast.BinaryExpr {
+	return &ast.BinaryExpr{
+		X:  x,
+		Op: op,
+		Y:  y,
+	}
+}
+
+func newNot(x ast.Expr) *ast.UnaryExpr {
+	return &ast.UnaryExpr{
+		Op: token.NOT,
+		X:  x,
+	}
+}
+
+func newAssign(lhs, rhs ast.Expr) *ast.AssignStmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{lhs},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{rhs},
+	}
+}
+
+func newDefine(name string, rhs ast.Expr) *ast.AssignStmt {
+	return &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent(name)},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{rhs},
+	}
+}
+
+func newIf(cond ast.Expr, list ...ast.Stmt) *ast.IfStmt {
+	return &ast.IfStmt{
+		Cond: cond,
+		Body: &ast.BlockStmt{
+			List: list,
+		},
+	}
+}
+
+func newSelector(x ast.Expr, name string) *ast.SelectorExpr {
+	return &ast.SelectorExpr{
+		X:   x,
+		Sel: ast.NewIdent(name),
+	}
+}
+
+func (g *generator) newCall(path, name string, args ...ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:  newSelector(g.use(path), name),
+		Args: args,
+	}
+}
+
+func (g *generator) newErrorReturn(format string, args ...ast.Expr) *ast.ReturnStmt {
+	return &ast.ReturnStmt{
+		Results: []ast.Expr{
+			ast.NewIdent(`nil`),
+			g.newCall(`fmt`, `Errorf`, append([]ast.Expr{newString(format)}, args...)...),
+		},
+	}
+}
+
+func newFieldSelector(item *Field) ast.Expr {
+	var x ast.Expr = ast.NewIdent(commandName)
+	for _, name := range item.Embedded {
+		x = newSelector(x, name)
+	}
+	return newSelector(x, item.Name)
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+var delegatedMethods = []struct {
+	name  string
+	param types.Type
+}{
+	{`Set`, types.Typ[types.String]},
+	{`UnmarshalText`, types.NewSlice(types.Typ[types.Byte])},
+	{`UnmarshalBinary`, types.NewSlice(types.Typ[types.Byte])},
+}
+
+func parseDelegated(info *types.Info, f *Field, expr ast.Expr) error {
+	if info == nil {
+		return fmt.Errorf(`type information isn't available`)
+	}
+	t := info.TypeOf(expr)
+	if t == nil {
+		return fmt.Errorf(`type can't be resolved`)
+	}
+	errorType := types.Universe.Lookup(`error`).Type()
+	methods := types.NewMethodSet(types.NewPointer(t))
+	for _, method := range delegatedMethods {
+		selection := methods.Lookup(nil, method.name)
+		if selection == nil {
+			continue
+		}
+		signature := selection.Type().(*types.Signature)
+		if signature.Params().Len() != 1 || !types.Identical(signature.Params().At(0).Type(), method.param) ||
+			signature.Results().Len() != 1 || !types.Identical(signature.Results().At(0).Type(), errorType) {
+			continue
+		}
+		f.VariableType = VariableDelegated
+		f.Method = method.name
+		f.TypeName = types.ExprString(expr)
+		f.TypePackage = typePackage(info, expr)
+		return nil
+	}
+	return fmt.Errorf(`%s implements neither Set(string) error nor encoding.TextUnmarshaler`, t)
+}
+
+func (g *generator) generateDelegatedVariable(item *Field, value ast.Expr) []ast.Stmt {
+	if item.Method != `Set` {
+		value = &ast.CallExpr{
+			Fun: &ast.ArrayType{
+				Elt: ast.NewIdent(`byte`),
+			},
+			Args: []ast.Expr{value},
+		}
+	}
+	var receiver ast.Expr = newFieldSelector(item)
+	var body []ast.Stmt
+	temporary := item.Slice || item.Map || item.Pointer
+	if temporary {
+		receiver = ast.NewIdent(`value`)
+		body = append(body, &ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: token.VAR,
+				Specs: []ast.Spec{
+					&ast.ValueSpec{
+						Names: []*ast.Ident{ast.NewIdent(`value`)},
+						Type:  g.typeExpr(item),
+					},
+				},
+			},
+		})
+	}
+	body = append(body, &ast.IfStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(`err`)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.CallExpr{
+					Fun:  newSelector(receiver, item.Method),
+					Args: []ast.Expr{value},
+				},
+			},
+		},
+		Cond: newBinary(ast.NewIdent(`err`), token.NEQ, ast.NewIdent(`nil`)),
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ReturnStmt{
+					Results: []ast.Expr{
+						ast.NewIdent(`nil`),
+						ast.NewIdent(`err`),
+					},
+				},
+			},
+		},
+	})
+	if temporary {
+		body = append(body, newAssign(newFieldSelector(item), ast.NewIdent(`value`)))
+	}
+	return body
+}
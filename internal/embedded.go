@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+)
+
+// isGroup reports whether the field is an embedded struct or a struct field
+// with the prefix property, both are flattened into the command.
+func isGroup(field *ast.Field) bool {
+	if len(field.Names) == 0 {
+		return true
+	}
+	props, err := parseProps(field)
+	_, ok := props[`prefix`]
+	return err == nil && ok
+}
+
+// parseEmbedded flattens the fields of a group, they are options unless their
+// tag says otherwise. The group itself is returned first as FieldEmbedded, so
+// a pointer to it can be allocated.
+func parseEmbedded(info *types.Info, field *ast.Field, path []string, prefix string) (Fields, error) {
+	if info == nil {
+		return nil, fmt.Errorf(`type information isn't available`)
+	}
+	props, err := parseProps(field)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range props {
+		if key != `prefix` {
+			return nil, fmt.Errorf(`undefined property '%s' of embedded struct`, key)
+		}
+		if len(value) > 0 {
+			prefix += value + `-`
+		}
+	}
+	f := Field{
+		Type:     FieldEmbedded,
+		Embedded: path,
+		Pos:      field.Pos(),
+	}
+	expr := field.Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		f.Pointer = true
+		expr = star.X
+	}
+	switch v := expr.(type) {
+	case *ast.Ident:
+		f.Name = v.Name
+	case *ast.SelectorExpr:
+		f.Name = v.Sel.Name
+	default:
+		return nil, fmt.Errorf(`embedded type %s isn't supported`, types.ExprString(expr))
+	}
+	if len(field.Names) > 1 {
+		return nil, fmt.Errorf(`multiple names for field`)
+	}
+	if len(field.Names) == 1 {
+		f.Name = field.Names[0].Name
+	}
+	f.TypeName = types.ExprString(expr)
+	f.TypePackage = typePackage(info, expr)
+	t := info.TypeOf(expr)
+	if t == nil {
+		return nil, fmt.Errorf(`type can't be resolved`)
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil, fmt.Errorf(`type with fields to flatten must be a struct`)
+	}
+	path = append(path[:len(path):len(path)], f.Name)
+	list := findStruct(info, st)
+	if list == nil {
+		if list, err = synthesizeStruct(info, st); err != nil {
+			return nil, err
+		}
+	}
+	fields := Fields{&f}
+	for _, item := range list.List {
+		if isGroup(item) {
+			embedded, err := parseEmbedded(info, item, path, prefix)
+			if err != nil {
+				return nil, fmt.Errorf(`%s: %s`, fieldName(item), err)
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		parsed, err := parseField(info, item, FieldOption)
+		if err != nil {
+			return nil, fmt.Errorf(`%s: %s`, item.Names[0].Name, err)
+		}
+		parsed.Embedded = path
+		if parsed.Type == FieldOption {
+			parsed.Long = prefix + parsed.Long
+		}
+		fields = append(fields, parsed)
+	}
+	return fields, nil
+}
+
+func fieldName(field *ast.Field) string {
+	if len(field.Names) > 0 {
+		return field.Names[0].Name
+	}
+	return types.ExprString(field.Type)
+}
+
+// findStruct returns fields of the struct declared in the checked files.
+func findStruct(info *types.Info, st *types.Struct) *ast.FieldList {
+	for expr, value := range info.Types {
+		if structType, ok := expr.(*ast.StructType); ok && value.Type == st {
+			return structType.Fields
+		}
+	}
+	return nil
+}
+
+// synthesizeStruct builds fields of a struct from another package, only its
+// type is known, and records their types so they parse like declared ones.
+func synthesizeStruct(info *types.Info, st *types.Struct) (*ast.FieldList, error) {
+	list := &ast.FieldList{}
+	for index := 0; index < st.NumFields(); index++ {
+		v := st.Field(index)
+		if !v.Exported() {
+			continue
+		}
+		expr, err := synthesizeType(info, v.Type())
+		if err != nil {
+			return nil, fmt.Errorf(`%s: %s`, v.Name(), err)
+		}
+		field := &ast.Field{
+			Type: expr,
+		}
+		if !v.Embedded() {
+			field.Names = []*ast.Ident{ast.NewIdent(v.Name())}
+		}
+		if tag := st.Tag(index); len(tag) > 0 {
+			field.Tag = &ast.BasicLit{
+				Kind:  token.STRING,
+				Value: strconv.Quote(tag),
+			}
+		}
+		list.List = append(list.List, field)
+	}
+	return list, nil
+}
+
+func synthesizeType(info *types.Info, t types.Type) (ast.Expr, error) {
+	var expr ast.Expr
+	switch v := t.(type) {
+	case *types.Basic:
+		expr = ast.NewIdent(v.Name())
+	case *types.Pointer:
+		elem, err := synthesizeType(info, v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.StarExpr{X: elem}
+	case *types.Slice:
+		elem, err := synthesizeType(info, v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.ArrayType{Elt: elem}
+	case *types.Map:
+		key, err := synthesizeType(info, v.Key())
+		if err != nil {
+			return nil, err
+		}
+		elem, err := synthesizeType(info, v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.MapType{Key: key, Value: elem}
+	case interface{ Obj() *types.TypeName }:
+		obj := v.Obj()
+		if obj.Pkg() == nil {
+			expr = ast.NewIdent(obj.Name())
+			break
+		}
+		if !obj.Exported() {
+			return nil, fmt.Errorf(`unexported type %s can't be used`, t)
+		}
+		x := ast.NewIdent(obj.Pkg().Name())
+		info.Uses[x] = types.NewPkgName(token.NoPos, nil, obj.Pkg().Name(), obj.Pkg())
+		expr = newSelector(x, obj.Name())
+	default:
+		return nil, fmt.Errorf(`type %s isn't supported`, t)
+	}
+	info.Types[expr] = types.TypeAndValue{Type: t}
+	return expr, nil
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// SetEnvPrefix gives every option without the env property an environment
+// variable derived from the prefix and the long name, e.g. APP_LISTEN_ADDR.
+func (c Commands) SetEnvPrefix(prefix string) {
+	if len(prefix) == 0 {
+		return
+	}
+	for _, command := range c {
+		for _, item := range command.Fields {
+			if item.Type == FieldOption && len(item.Env) == 0 {
+				item.Env = formatEnv(prefix, item.Long)
+			}
+		}
+	}
+}
+
+func formatEnv(prefix, long string) string {
+	name := strings.ToUpper(strings.Replace(long, `-`, `_`, -1))
+	return strings.TrimSuffix(prefix, `_`) + `_` + name
+}
+
+func (g *generator) generateEnv(item *Field) ast.Stmt {
+	cond := newBinary(
+		newBinary(ast.NewIdent(`item`), token.NEQ, newString(``)),
+		token.LAND,
+		newNot(ast.NewIdent(setMarkName(item))),
+	)
+	stmt := newIf(cond, append(g.wrapEnvErrors(g.generateSetVariable(item, ast.NewIdent(`item`)), item.Env), generateSetMark(item)...)...)
+	stmt.Init = newDefine(`item`, g.newCall(`os`, `Getenv`, newString(item.Env)))
+	return stmt
+}
+
+// wrapEnvErrors adds the variable name to the errors returned by list.
+func (g *generator) wrapEnvErrors(list []ast.Stmt, env string) []ast.Stmt {
+	for _, stmt := range list {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				if len(node.Results) == 2 {
+					node.Results[1] = g.newCall(`fmt`, `Errorf`, newString(`environment variable %s: %w`), newString(env), node.Results[1])
+				}
+			}
+			return true
+		})
+	}
+	return list
+}
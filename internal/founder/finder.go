@@ -1,23 +1,39 @@
 package founder
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
 )
 
 type (
 	Founder interface {
 		GetTypes(names ...string) ([]*ast.TypeSpec, error)
-		GetFunctions(names ...string) ([]*ast.FuncType, error)
-		GetMethodsForStruct(structName string, methodsName ...string) ([]*ast.FuncType, error)
+		GetPackageTypes(names ...string) ([]*ast.TypeSpec, error)
+		GetTypeAfterLine(fileName string, line int) (*ast.TypeSpec, error)
+		GetTypesByDirective(directive string) ([]*TypeDirective, error)
+		GetFunctions(names ...string) ([]*ast.FuncDecl, error)
+		GetMethodsForStruct(structName string, methodsName ...string) ([]*ast.FuncDecl, error)
 		GetPackage() string
 		GetFileSet() *token.FileSet
+		GetTypesInfo() *types.Info
+	}
+	// TypeDirective is a type marked with a comment directive such as
+	// //coge:command name=serve, Args holds its key=value arguments.
+	TypeDirective struct {
+		Type *ast.TypeSpec
+		Args map[string]string
 	}
 	founder struct {
-	file     *ast.File
-	packages map[string]*ast.Package
-	fileSet  *token.FileSet
-}
+		name    string
+		file    *ast.File
+		syntax  []*ast.File
+		fileSet *token.FileSet
+		info    *types.Info
+	}
 )
 
 func (f *founder) GetFileSet() *token.FileSet {
@@ -25,7 +41,24 @@ func (f *founder) GetFileSet() *token.FileSet {
 }
 
 func (f *founder) GetPackage() string {
-	return f.file.Name.Name
+	return f.name
+}
+
+func (f *founder) GetTypesInfo() *types.Info {
+	return f.info
+}
+
+func (f *founder) files() []*ast.File {
+	if f.file != nil {
+		return []*ast.File{f.file}
+	}
+	return f.packageFiles()
+}
+
+// packageFiles returns all files of the package in the load order, also
+// when the founder was created for a single file.
+func (f *founder) packageFiles() []*ast.File {
+	return f.syntax
 }
 
 func (f *founder) GetTypes(names ...string) ([]*ast.TypeSpec, error) {
@@ -36,7 +69,42 @@ func (f *founder) GetTypes(names ...string) ([]*ast.TypeSpec, error) {
 	}
 }
 
-func (f *founder) GetFunctions(names ...string) ([]*ast.FuncType, error) {
+// GetPackageTypes looks the types up in the whole package, also when the
+// founder was created for a single file.
+func (f *founder) GetPackageTypes(names ...string) ([]*ast.TypeSpec, error) {
+	return f.findTypesInPackages(names)
+}
+
+func (f *founder) GetTypeAfterLine(fileName string, line int) (*ast.TypeSpec, error) {
+	for _, file := range f.files() {
+		if filepath.Base(f.fileSet.Position(file.Pos()).Filename) != filepath.Base(fileName) {
+			continue
+		}
+		if t := foundTypeAfterLine(f.fileSet, file, line); t != nil {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`type after line %d not found in '%s'`, line, fileName)
+}
+
+func (f *founder) GetTypesByDirective(directive string) ([]*TypeDirective, error) {
+	var res []*TypeDirective
+	for _, file := range f.files() {
+		found, err := foundTypesByDirective(f.fileSet, file, directive)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, found...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Type.Pos() < res[j].Type.Pos()
+	})
+
+	return res, nil
+}
+
+func (f *founder) GetFunctions(names ...string) ([]*ast.FuncDecl, error) {
 	if f.file != nil {
 		return f.findFunctionsInFile(names)
 	} else {
@@ -45,27 +113,38 @@ func (f *founder) GetFunctions(names ...string) ([]*ast.FuncType, error) {
 }
 
 func (f *founder) findTypesInPackages(names []string) (res []*ast.TypeSpec, err error) {
-	for _, p := range f.packages {
-		for _, file := range p.Files {
-			fr, err := foundTypesInFile(file, names)
-			if err != nil {
-				return nil, err
-			}
-			res = append(res, fr...)
+	for _, file := range f.syntax {
+		fr, err := foundTypesInFile(file, names)
+		if err != nil {
+			return nil, err
 		}
+		res = append(res, fr...)
 	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Pos() < res[j].Pos()
+	})
 
 	return res, nil
 }
 
-func (f *founder) findFunctionsInFile(names []string) ([]*ast.FuncType, error) {
-	panic("implement me")
+func (f *founder) findFunctionsInFile(names []string) ([]*ast.FuncDecl, error) {
+	return foundFunctionsInFile(f.file, names), nil
 }
 
-func (f *founder) findFunctionsInPackages(names []string) ([]*ast.FuncType, error) {
-	panic("implement me")
+func (f *founder) findFunctionsInPackages(names []string) (res []*ast.FuncDecl, err error) {
+	for _, file := range f.syntax {
+		res = append(res, foundFunctionsInFile(file, names)...)
+	}
+
+	return res, nil
 }
 
-func (f *founder) GetMethodsForStruct(structName string, methodsName ...string) ([]*ast.FuncType, error) {
-	panic("implement me")
+func (f *founder) GetMethodsForStruct(structName string, methodsName ...string) ([]*ast.FuncDecl, error) {
+	var res []*ast.FuncDecl
+	// methods may be declared in any file of the package
+	for _, file := range f.packageFiles() {
+		res = append(res, foundMethodsInFile(file, structName, methodsName)...)
+	}
+
+	return res, nil
 }
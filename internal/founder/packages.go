@@ -0,0 +1,78 @@
+package founder
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// NewLoadedFounder loads the package of path, a directory or a .go file, with
+// go/packages, so modules, build tags and imported types are respected and
+// the type information is complete.
+func NewLoadedFounder(path, packageName string) (Founder, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, pattern := abs, `.`
+	if !stat.IsDir() {
+		dir, pattern = filepath.Dir(abs), `file=`+abs
+	}
+	config := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir:  dir,
+		Fset: token.NewFileSet(),
+	}
+	pkgs, err := packages.Load(config, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var pkg *packages.Package
+	for _, p := range pkgs {
+		if len(packageName) == 0 || p.Name == packageName {
+			if pkg != nil {
+				return nil, fmt.Errorf(`expected one package in '%s', found %s and %s`, path, pkg.Name, p.Name)
+			}
+			pkg = p
+		}
+	}
+	if pkg == nil && len(packageName) == 0 {
+		return nil, fmt.Errorf(`no package found in '%s'`, path)
+	}
+	if pkg == nil {
+		return nil, fmt.Errorf(`package '%s' not found in '%s'`, packageName, path)
+	}
+	for _, e := range pkg.Errors {
+		// generated files may be stale, so type errors, also reported by go list
+		// as compile errors, don't stop the generation
+		if e.Kind == packages.ParseError || len(pkg.Syntax) == 0 {
+			return nil, e
+		}
+	}
+	f := founder{
+		name:    pkg.Name,
+		fileSet: config.Fset,
+		info:    pkg.TypesInfo,
+	}
+	for _, file := range pkg.Syntax {
+		name := config.Fset.Position(file.Pos()).Filename
+		if !isGoSource(filepath.Base(name)) {
+			continue
+		}
+		if name == abs {
+			f.file = file
+		}
+		f.syntax = append(f.syntax, file)
+	}
+	if !stat.IsDir() && f.file == nil {
+		return nil, fmt.Errorf(`file '%s' isn't a part of the package '%s'`, path, pkg.Name)
+	}
+	return &f, nil
+}
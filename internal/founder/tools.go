@@ -1,33 +1,12 @@
 package founder
 
 import (
+	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
-	"os"
 	"strings"
 )
 
-func NewFounder(path string) (Founder, error) {
-	f := founder{}
-	info, err := os.Stat(path)
-	if err != nil {
-		return nil, err
-	}
-	f.fileSet = token.NewFileSet()
-	flags := parser.AllErrors
-	if info.IsDir() {
-		if f.packages, err = parser.ParseDir(f.fileSet, path, filterGoFile, flags); err != nil {
-			return nil, err
-		}
-	} else {
-		if f.file, err = parser.ParseFile(f.fileSet, path, nil, flags); err != nil {
-			return nil, err
-		}
-	}
-	return &f, nil
-}
-
 func hasName(name string, names []string) bool {
 	for _, n := range names {
 		if n == name {
@@ -37,9 +16,29 @@ func hasName(name string, names []string) bool {
 	return false
 }
 
-func filterGoFile(info os.FileInfo) bool {
-	return !strings.HasSuffix(info.Name(), `_generated.go`) &&
-		!strings.HasSuffix(info.Name(), `_test.go`)
+func isGoSource(name string) bool {
+	return !strings.HasSuffix(name, `_generated.go`) &&
+		!strings.HasSuffix(name, `_test.go`)
+}
+
+func foundTypeAfterLine(fileSet *token.FileSet, file *ast.File, line int) *ast.TypeSpec {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if ok && fileSet.Position(typeSpec.Pos()).Line > line {
+				if typeSpec.Doc == nil && len(genDecl.Specs) == 1 {
+					typeSpec.Doc = genDecl.Doc
+				}
+				return typeSpec
+			}
+		}
+	}
+
+	return nil
 }
 
 func foundTypesInFile(file *ast.File, names []string) (res []*ast.TypeSpec, err error) {
@@ -53,9 +52,96 @@ func foundTypesInFile(file *ast.File, names []string) (res []*ast.TypeSpec, err
 			if !ok || !hasName(typeSpec.Name.Name, names) {
 				continue
 			}
+			if typeSpec.Doc == nil && len(genDecl.Specs) == 1 {
+				typeSpec.Doc = genDecl.Doc
+			}
 			res = append(res, typeSpec)
 		}
 	}
 
 	return res, nil
-}
\ No newline at end of file
+}
+
+func foundMethodsInFile(file *ast.File, structName string, names []string) (res []*ast.FuncDecl) {
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 {
+			continue
+		}
+		recv := funcDecl.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if ident, ok := recv.(*ast.Ident); !ok || ident.Name != structName {
+			continue
+		}
+		if len(names) == 0 || hasName(funcDecl.Name.Name, names) {
+			res = append(res, funcDecl)
+		}
+	}
+
+	return res
+}
+
+func foundFunctionsInFile(file *ast.File, names []string) (res []*ast.FuncDecl) {
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv != nil {
+			continue
+		}
+		if len(names) == 0 || hasName(funcDecl.Name.Name, names) {
+			res = append(res, funcDecl)
+		}
+	}
+
+	return res
+}
+
+func foundTypesByDirective(fileSet *token.FileSet, file *ast.File, directive string) (res []*TypeDirective, err error) {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			if typeSpec.Doc == nil && len(genDecl.Specs) == 1 {
+				typeSpec.Doc = genDecl.Doc
+			}
+			args, ok, err := parseDirective(typeSpec.Doc, directive)
+			if err != nil {
+				return nil, fmt.Errorf(`%s: %s`, fileSet.Position(typeSpec.Pos()), err)
+			}
+			if ok {
+				res = append(res, &TypeDirective{Type: typeSpec, Args: args})
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func parseDirective(doc *ast.CommentGroup, directive string) (map[string]string, bool, error) {
+	if doc == nil {
+		return nil, false, nil
+	}
+	for _, comment := range doc.List {
+		fields := strings.Fields(comment.Text)
+		if len(fields) == 0 || fields[0] != directive {
+			continue
+		}
+		args := map[string]string{}
+		for _, field := range fields[1:] {
+			pair := strings.SplitN(field, `=`, 2)
+			if len(pair) != 2 || len(pair[0]) == 0 {
+				return nil, false, fmt.Errorf(`wrong argument '%s' of %s, expected key=value`, field, directive)
+			}
+			args[pair[0]] = pair[1]
+		}
+		return args, true, nil
+	}
+	return nil, false, nil
+}
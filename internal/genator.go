@@ -1,52 +1,182 @@
 package internal
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/printer"
 	"go/token"
+	"io"
+	pathpkg "path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var (
-	reName  = regexp.MustCompile(`[A-Z][^A-Z]*`)
-	strconv = false
-)
+type generator struct {
+	imports         map[string]string
+	missingError    bool
+	validationError bool
+}
+
+var reName = regexp.MustCompile(`[A-Z][^A-Z]*`)
 
 const (
-	commandName        = `_command`
-	valuesVariableName = `values`
+	commandName         = `_command`
+	valuesVariableName  = `values`
+	indexName           = `index`
+	argumentCountName   = `argumentCount`
+	positionName        = `position`
+	optionValueName     = `optionValue`
+	elementName         = `element`
+	pairName            = `pair`
+	pointerValueName    = `pointerValue`
+	endOfOptionsName    = `endOfOptions`
+	helpErrorName       = `HelpError`
+	missingErrorName    = `MissingError`
+	validationErrorName = `ValidationError`
+	generatedHeader     = "// Code generated by coge-cli. DO NOT EDIT.\n\n"
 )
 
-func Generate(command *Command) error {
-	strconv = false
-	argumentCountName := `argumentCount`
-	file := &ast.File{}
-	file.Name = &ast.Ident{
-		NamePos: 0,
-		Name:    command.Package,
-		Obj:     nil,
+// SupportFileName is the file written next to the generated files of a
+// package, it declares the types shared by them.
+const SupportFileName = `coge_cli_support_generated.go`
+
+// Generate writes the constructors of commands to writer. With support the
+// shared types are written too, otherwise they are expected in the support
+// file written by GenerateSupport.
+func Generate(writer io.Writer, commands Commands, support bool) error {
+	if len(commands) == 0 {
+		return fmt.Errorf(`nothing to generate`)
+	}
+	g := generator{
+		imports: map[string]string{},
+	}
+	file := &ast.File{
+		Name: ast.NewIdent(commands[0].Package),
+	}
+	commands.setTitles()
+	var decls []ast.Decl
+	for _, command := range commands {
+		if command.Package != commands[0].Package {
+			return fmt.Errorf(`command '%s' from package '%s' can't be generated with package '%s'`, command.Name, command.Package, commands[0].Package)
+		}
+		decl, err := g.generateConstructor(command)
+		if err != nil {
+			return err
+		}
+		if len(command.Commands) == 0 {
+			decls = append(decls, decl, g.generateUsage(command))
+			continue
+		}
+		if linked := commands.Linked(); len(linked) > 0 {
+			return fmt.Errorf(`subcommand types '%s' must be generated too`, strings.Join(linked, `, `))
+		}
+		for _, item := range command.Commands {
+			if len(item.Description) == 0 {
+				item.Description = commands.find(item.TypeName).Description
+			}
+		}
+		decls = append(decls, decl, g.generateUsage(command), g.generateSubcommand(command, commands))
+	}
+	main := g.generateMain(commands)
+	shared := &bytes.Buffer{}
+	if support {
+		g.use(`errors`)
+		shared.WriteString(helpErrorSource)
+	}
+	if support && g.missingError {
+		g.use(`strings`)
+		shared.WriteString(missingErrorSource)
+	}
+	if support && g.validationError {
+		shared.WriteString(validationErrorSource)
+	}
+	if importDecl := g.generateImports(); importDecl != nil {
+		file.Decls = append(file.Decls, importDecl)
+	}
+
+	fileSet := token.NewFileSet()
+	buffer := bytes.NewBufferString(generatedHeader)
+	if err := printer.Fprint(buffer, fileSet, file); err != nil {
+		return err
 	}
+	for _, decl := range decls {
+		buffer.WriteString("\n\n")
+		if err := printer.Fprint(buffer, fileSet, decl); err != nil {
+			return err
+		}
+	}
+	buffer.Write(shared.Bytes())
+	buffer.WriteString(main)
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(source)
+	return err
+}
+
+// GenerateSupport writes the support file of the package packageName.
+func GenerateSupport(writer io.Writer, packageName string) error {
+	buffer := bytes.NewBufferString(generatedHeader)
+	_, _ = fmt.Fprintf(buffer, "package %s\n\nimport (\n\t\"errors\"\n\t\"strings\"\n)\n", packageName)
+	buffer.WriteString(helpErrorSource)
+	buffer.WriteString(missingErrorSource)
+	buffer.WriteString(validationErrorSource)
+	source, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(source)
+	return err
+}
+
+func (g *generator) generateImports() *ast.GenDecl {
+	if len(g.imports) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
 	importDecl := &ast.GenDecl{
 		Tok: token.IMPORT,
-		Specs: []ast.Spec{
-			&ast.ImportSpec{
-				Path: &ast.BasicLit{
-					Value: `"fmt"`,
-				},
-			},
-			&ast.ImportSpec{
-				Path: &ast.BasicLit{
-					Value: `"strings"`,
-				},
+	}
+	if len(paths) > 1 {
+		importDecl.Lparen = 1
+	}
+	for _, path := range paths {
+		spec := &ast.ImportSpec{
+			Path: &ast.BasicLit{
+				Kind:  token.STRING,
+				Value: fmt.Sprintf(`%q`, path),
 			},
-		},
+		}
+		if name := g.imports[path]; name != pathpkg.Base(path) {
+			spec.Name = ast.NewIdent(name)
+		}
+		importDecl.Specs = append(importDecl.Specs, spec)
 	}
-	forBodyStmt := &ast.BlockStmt{
-		List: []ast.Stmt{
+	return importDecl
+}
 
-		},
+func (g *generator) use(path string) *ast.Ident {
+	return g.useNamed(path, pathpkg.Base(path))
+}
+
+func (g *generator) useNamed(path, name string) *ast.Ident {
+	g.imports[path] = name
+	return ast.NewIdent(name)
+}
+
+func (g *generator) generateConstructor(command *Command) (*ast.FuncDecl, error) {
+	forBodyStmt := &ast.BlockStmt{
+		List: []ast.Stmt{},
 	}
 	funcBodyStmt := &ast.BlockStmt{
 		List: []ast.Stmt{
@@ -63,6 +193,62 @@ func Generate(command *Command) error {
 			},
 		},
 	}
+	for _, item := range command.Embedded {
+		if item.Pointer {
+			funcBodyStmt.List = append(funcBodyStmt.List, newAssign(newFieldSelector(item), &ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: g.typeExpr(item),
+				},
+			}))
+		}
+	}
+	var afterLoop []ast.Stmt
+	for _, item := range command.Fields {
+		if len(item.Default) == 0 {
+			continue
+		}
+		if item.VariableType == VariableDelegated {
+			if item.Slice || item.Map {
+				return nil, fmt.Errorf(`%s: default value isn't supported for %s`, command.position(item), item.typeName())
+			}
+			funcBodyStmt.List = append(funcBodyStmt.List, g.generateDelegatedVariable(item, newString(item.Default))...)
+			continue
+		}
+		value, err := g.formatDefault(item)
+		if err != nil {
+			return nil, fmt.Errorf(`%s: wrong default value '%s': %s`, command.position(item), item.Default, err)
+		}
+		if item.Slice || item.Map {
+			afterLoop = append(afterLoop, newIf(newBinary(newFieldSelector(item), token.EQL, ast.NewIdent(`nil`)),
+				newAssign(newFieldSelector(item), value),
+			))
+			continue
+		}
+		funcBodyStmt.List = append(funcBodyStmt.List, &ast.AssignStmt{
+			Lhs: []ast.Expr{
+				newFieldSelector(item),
+			},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{
+				value,
+			},
+		})
+	}
+	funcBodyStmt.List = append(funcBodyStmt.List, newDefine(endOfOptionsName, ast.NewIdent(`false`)))
+	for _, item := range command.Fields {
+		if hasSetMark(item) {
+			funcBodyStmt.List = append(funcBodyStmt.List, newDefine(setMarkName(item), ast.NewIdent(`false`)))
+		}
+	}
+	// env is read after the options, so given options win over it
+	var envAfterLoop []ast.Stmt
+	for _, item := range command.Fields {
+		if len(item.Env) > 0 {
+			envAfterLoop = append(envAfterLoop, g.generateEnv(item))
+		}
+	}
+	afterLoop = append(envAfterLoop, afterLoop...)
 	if len(command.Arguments) > 0 {
 		funcBodyStmt.List = append(funcBodyStmt.List, &ast.AssignStmt{
 			Lhs: []ast.Expr{
@@ -77,12 +263,18 @@ func Generate(command *Command) error {
 			},
 		})
 	}
-	funcBodyStmt.List = append(funcBodyStmt.List, &ast.RangeStmt{
-		Key:   ast.NewIdent(`_`),
-		Value: ast.NewIdent(`item`),
-		Tok:   token.DEFINE,
-		X:     ast.NewIdent(`items`),
-		Body:  forBodyStmt,
+	funcBodyStmt.List = append(funcBodyStmt.List, &ast.ForStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(indexName)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{newInt(0)},
+		},
+		Cond: newBinary(ast.NewIdent(indexName), token.LSS, newLen(ast.NewIdent(`items`))),
+		Post: &ast.IncDecStmt{
+			X:   ast.NewIdent(indexName),
+			Tok: token.INC,
+		},
+		Body: forBodyStmt,
 	})
 	funcBodyStmt.List = append(funcBodyStmt.List, &ast.ReturnStmt{
 		Results: []ast.Expr{
@@ -93,99 +285,81 @@ func Generate(command *Command) error {
 			ast.NewIdent(`nil`),
 		},
 	})
-	file.Decls = []ast.Decl{
-		importDecl,
-		&ast.FuncDecl{
-			Name: &ast.Ident{
-				Name: `New` + strings.Title(command.Name),
-			},
-			Type: &ast.FuncType{
-				Params: &ast.FieldList{
-					List: []*ast.Field{
-						{
-							Names: []*ast.Ident{
-								{
-									Name: `items`,
-								},
-							},
-							Type: &ast.Ellipsis{
-								Elt: ast.NewIdent(`string`),
+	funcDecl := &ast.FuncDecl{
+		Name: &ast.Ident{
+			Name: `New` + strings.Title(command.Name),
+		},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Names: []*ast.Ident{
+							{
+								Name: `items`,
 							},
 						},
+						Type: &ast.Ellipsis{
+							Elt: ast.NewIdent(`string`),
+						},
 					},
 				},
-				Results: &ast.FieldList{
-					List: []*ast.Field{
-						{
-							Type: &ast.StarExpr{
-								X: ast.NewIdent(command.Name),
-							},
+			},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Type: &ast.StarExpr{
+							X: ast.NewIdent(command.Name),
 						},
-						{
-							Type: ast.NewIdent(`error`),
+					},
+					{
+						Type: ast.NewIdent(`error`),
+					},
+				},
+			},
+		},
+		Body: funcBodyStmt,
+	}
+	help := &ast.ReturnStmt{
+		Results: []ast.Expr{
+			ast.NewIdent(`nil`),
+			&ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: ast.NewIdent(helpErrorName),
+					Elts: []ast.Expr{
+						&ast.KeyValueExpr{
+							Key: ast.NewIdent(`Usage`),
+							Value: &ast.CallExpr{
+								Fun: newSelector(ast.NewIdent(commandName), `Usage`),
+							},
 						},
 					},
 				},
 			},
-			Body: funcBodyStmt,
 		},
 	}
-	if len(command.LongOptions) > 0 {
-		caseTag := func(item *Field) string {
-			return fmt.Sprintf("`%s`", formatLongOption(item.Name))
-		}
-		forBodyStmt.List = append(forBodyStmt.List, generateOptionCase("`--`", `long`, command.LongOptions, caseTag))
+	caseTag := func(item *Field) string {
+		return fmt.Sprintf("`%s`", item.Long)
 	}
-	if len(command.ShortOptions) > 0 {
-		caseTag := func(item *Field) string {
-			return fmt.Sprintf("`%s`", item.Short)
-		}
-		ifStmt := generateOptionCase("`-`", `short`, command.ShortOptions, caseTag)
-		if len(forBodyStmt.List) == 0 {
-			forBodyStmt.List = append(forBodyStmt.List, ifStmt)
-		} else {
-			//TODO: Сделать проверки что бы избежать паники
-			forBodyStmt.List[len(forBodyStmt.List)-1].(*ast.IfStmt).Else = ifStmt
-		}
+	negationTag := func(item *Field) string {
+		return fmt.Sprintf("`no-%s`", item.Long)
+	}
+	var longHelp, shortHelp *ast.ReturnStmt
+	if !command.hasLong(`help`) {
+		longHelp = help
 	}
+	if !command.hasShort(`h`) {
+		shortHelp = help
+	}
+	ifStmt := g.generateOptionCase("`--`", `long`, command.LongOptions, caseTag, negationTag, longHelp)
+	ifStmt.Else = g.generateShortOptionCase(command.ShortOptions, shortHelp)
+	forBodyStmt.List = append(forBodyStmt.List, ifStmt)
 	if len(command.Arguments) > 0 {
 		body := &ast.BlockStmt{
 			List: make([]ast.Stmt, len(command.Arguments)+1),
 		}
 		block := &ast.BlockStmt{
 			List: []ast.Stmt{
-				&ast.ForStmt{
-					Cond: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{
-							X:   ast.NewIdent(`strings`),
-							Sel: ast.NewIdent(`HasPrefix`),
-						},
-						Args: []ast.Expr{
-							ast.NewIdent(`item`),
-							&ast.BasicLit{
-								Kind:  token.STRING,
-								Value: "`\\`",
-							},
-						},
-					},
-					Body: &ast.BlockStmt{
-						List: []ast.Stmt{
-							&ast.AssignStmt{
-								Lhs: []ast.Expr{ast.NewIdent(`item`),},
-								Tok: token.ASSIGN,
-								Rhs: []ast.Expr{
-									&ast.SliceExpr{
-										X: ast.NewIdent(`item`),
-										Low: &ast.BasicLit{
-											Kind:  token.INT,
-											Value: `1`,
-										},
-									},
-								},
-							},
-						},
-					},
-				},
 				&ast.SwitchStmt{
 					Tag:  ast.NewIdent(argumentCountName),
 					Body: body,
@@ -195,7 +369,7 @@ func Generate(command *Command) error {
 		if len(forBodyStmt.List) == 0 {
 			forBodyStmt.List = append(forBodyStmt.List, block)
 		} else if err := appendToEndElse(forBodyStmt.List[len(forBodyStmt.List)-1].(*ast.IfStmt), block); err != nil {
-			return err
+			return nil, err
 		}
 		for index, item := range command.Arguments {
 			body.List[index] = &ast.CaseClause{
@@ -205,10 +379,13 @@ func Generate(command *Command) error {
 						Value: fmt.Sprintf(`%d`, len(command.Arguments)-index),
 					},
 				},
-				Body: append(generateFormatVariable(item, ast.NewIdent(`item`)), &ast.IncDecStmt{
-					X:      ast.NewIdent(argumentCountName),
-					Tok:    token.DEC,
-				}),
+				Body: g.generateSetVariable(item, ast.NewIdent(`item`)),
+			}
+			if !item.Slice {
+				body.List[index].(*ast.CaseClause).Body = append(body.List[index].(*ast.CaseClause).Body, &ast.IncDecStmt{
+					X:   ast.NewIdent(argumentCountName),
+					Tok: token.DEC,
+				})
 			}
 		}
 		body.List[len(body.List)-1] = &ast.CaseClause{
@@ -218,7 +395,7 @@ func Generate(command *Command) error {
 						ast.NewIdent(`nil`),
 						&ast.CallExpr{
 							Fun: &ast.SelectorExpr{
-								X:   ast.NewIdent(`fmt`),
+								X:   g.use(`fmt`),
 								Sel: ast.NewIdent(`Errorf`),
 							},
 							Args: []ast.Expr{
@@ -233,16 +410,46 @@ func Generate(command *Command) error {
 				},
 			},
 		}
+	} else {
+		block := &ast.BlockStmt{
+			List: []ast.Stmt{
+				g.newErrorReturn(`wrong argument '%s'`, ast.NewIdent(`item`)),
+			},
+		}
+		if len(command.Commands) > 0 {
+			block = g.generateCommandSwitch(command)
+		}
+		if len(forBodyStmt.List) == 0 {
+			forBodyStmt.List = append(forBodyStmt.List, block.List...)
+		} else if err := appendToEndElse(forBodyStmt.List[len(forBodyStmt.List)-1].(*ast.IfStmt), block); err != nil {
+			return nil, err
+		}
 	}
-	if strconv {
-		importDecl.Specs = append(importDecl.Specs, &ast.ImportSpec{
-			Path: &ast.BasicLit{
-				Value: `"strconv"`,
+	forBodyStmt.List = append([]ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(`item`)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{
+				&ast.IndexExpr{
+					X:     ast.NewIdent(`items`),
+					Index: ast.NewIdent(indexName),
+				},
 			},
-		})
+		},
+		newIf(newBinary(newNot(ast.NewIdent(endOfOptionsName)), token.LAND, newBinary(ast.NewIdent(`item`), token.EQL, newString(`--`))),
+			newAssign(ast.NewIdent(endOfOptionsName), ast.NewIdent(`true`)),
+			&ast.BranchStmt{
+				Tok: token.CONTINUE,
+			},
+		),
+	}, forBodyStmt.List...)
+	afterLoop = append(afterLoop, g.generateRequiredCheck(command)...)
+	if len(afterLoop) > 0 {
+		last := len(funcBodyStmt.List) - 1
+		funcBodyStmt.List = append(funcBodyStmt.List[:last], append(afterLoop, funcBodyStmt.List[last])...)
 	}
 
-	return printer.Fprint(command.Writer, command.FileSet, file)
+	return funcDecl, nil
 }
 
 func appendToEndElse(stmt *ast.IfStmt, block *ast.BlockStmt) error {
@@ -258,12 +465,14 @@ func appendToEndElse(stmt *ast.IfStmt, block *ast.BlockStmt) error {
 	return fmt.Errorf(`samething wrong`)
 }
 
-func generateOptionCase(optionPrefix, optionType string, options Fields, caseTag func(item *Field) string) *ast.IfStmt {
-	switchBodyStmt := make([]ast.Stmt, len(options)+1)
+func (g *generator) generateOptionCase(optionPrefix, optionType string, options Fields, caseTag, negationTag func(item *Field) string, help ast.Stmt) *ast.IfStmt {
+	switchBodyStmt := &ast.BlockStmt{
+		List: make([]ast.Stmt, 0, len(options)+2),
+	}
 	var ifStmt = &ast.IfStmt{
-		Cond: &ast.CallExpr{
+		Cond: newBinary(newNot(ast.NewIdent(endOfOptionsName)), token.LAND, &ast.CallExpr{
 			Fun: &ast.SelectorExpr{
-				X:   ast.NewIdent(`strings`),
+				X:   g.use(`strings`),
 				Sel: ast.NewIdent(`HasPrefix`),
 			},
 			Args: []ast.Expr{
@@ -275,7 +484,7 @@ func generateOptionCase(optionPrefix, optionType string, options Fields, caseTag
 			},
 			Ellipsis: 0,
 			Rparen:   0,
-		},
+		}),
 		Body: &ast.BlockStmt{
 			List: []ast.Stmt{
 				&ast.AssignStmt{
@@ -286,7 +495,7 @@ func generateOptionCase(optionPrefix, optionType string, options Fields, caseTag
 					Rhs: []ast.Expr{
 						&ast.CallExpr{
 							Fun: &ast.SelectorExpr{
-								X:   ast.NewIdent(`strings`),
+								X:   g.use(`strings`),
 								Sel: ast.NewIdent(`SplitN`),
 							},
 							Args: []ast.Expr{
@@ -319,39 +528,87 @@ func generateOptionCase(optionPrefix, optionType string, options Fields, caseTag
 							Value: `0`,
 						},
 					},
-					Body: &ast.BlockStmt{
-						List: switchBodyStmt,
-					},
+					Body: switchBodyStmt,
 				},
 			},
 		},
 		Else: nil,
 	}
-	for index, item := range options {
-		switchBodyStmt[index] = &ast.CaseClause{
+	if help != nil {
+		switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
+			List: []ast.Expr{
+				newString(`help`),
+			},
+			Body: []ast.Stmt{help},
+		})
+	}
+	for _, item := range options {
+		body := g.generateSetVariable(item, newIndex(valuesVariableName, 1))
+		if !item.isFlag() {
+			body = append([]ast.Stmt{
+				newIf(newBinary(newLen(ast.NewIdent(valuesVariableName)), token.EQL, newInt(1)),
+					newIf(newBinary(newBinary(ast.NewIdent(indexName), token.ADD, newInt(1)), token.EQL, newLen(ast.NewIdent(`items`))),
+						g.newErrorReturn(`option '%s' requires a value`, ast.NewIdent(`item`)),
+					),
+					&ast.IncDecStmt{
+						X:   ast.NewIdent(indexName),
+						Tok: token.INC,
+					},
+					newAssign(ast.NewIdent(valuesVariableName), &ast.CallExpr{
+						Fun: ast.NewIdent(`append`),
+						Args: []ast.Expr{
+							ast.NewIdent(valuesVariableName),
+							&ast.IndexExpr{
+								X:     ast.NewIdent(`items`),
+								Index: ast.NewIdent(indexName),
+							},
+						},
+					}),
+				),
+			}, body...)
+		} else {
+			body = append([]ast.Stmt{
+				newIf(newBinary(newLen(ast.NewIdent(valuesVariableName)), token.EQL, newInt(1)),
+					newAssign(ast.NewIdent(valuesVariableName), &ast.CallExpr{
+						Fun:  ast.NewIdent(`append`),
+						Args: []ast.Expr{ast.NewIdent(valuesVariableName), newString(`true`)},
+					}),
+				),
+			}, body...)
+		}
+		switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
 			List: []ast.Expr{
 				&ast.BasicLit{
 					Kind:  token.STRING,
 					Value: caseTag(item),
 				},
 			},
-			Body: generateFormatVariable(item, &ast.IndexExpr{
-				X: ast.NewIdent(valuesVariableName),
-				Index: &ast.BasicLit{
-					Kind:  token.INT,
-					Value: `1`,
+			Body: append(body, generateSetMark(item)...),
+		})
+		if item.isFlag() && negationTag != nil {
+			switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
+				List: []ast.Expr{
+					&ast.BasicLit{
+						Kind:  token.STRING,
+						Value: negationTag(item),
+					},
 				},
-			}),
+				Body: append([]ast.Stmt{
+					newIf(newBinary(newLen(ast.NewIdent(valuesVariableName)), token.GTR, newInt(1)),
+						g.newErrorReturn(`option '%s' doesn't take a value from '%s'`, newIndex(valuesVariableName, 0), ast.NewIdent(`item`)),
+					),
+				}, append(negateVariable(item), generateSetMark(item)...)...),
+			})
 		}
 	}
-	switchBodyStmt[len(options)] = &ast.CaseClause{
+	switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
 		Body: []ast.Stmt{
 			&ast.ReturnStmt{
 				Results: []ast.Expr{
 					ast.NewIdent(`nil`),
 					&ast.CallExpr{
 						Fun: &ast.SelectorExpr{
-							X:   ast.NewIdent(`fmt`),
+							X:   g.use(`fmt`),
 							Sel: ast.NewIdent(`Errorf`),
 						},
 						Args: []ast.Expr{
@@ -372,21 +629,245 @@ func generateOptionCase(optionPrefix, optionType string, options Fields, caseTag
 				},
 			},
 		},
-	}
+	})
 	return ifStmt
 }
 
-func generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
+func (g *generator) generateShortOptionCase(options Fields, help ast.Stmt) *ast.IfStmt {
+	current := &ast.IndexExpr{
+		X:     ast.NewIdent(`item`),
+		Index: ast.NewIdent(positionName),
+	}
+	rest := &ast.SliceExpr{
+		X:   ast.NewIdent(`item`),
+		Low: newBinary(ast.NewIdent(positionName), token.ADD, newInt(1)),
+	}
+	stop := newAssign(ast.NewIdent(positionName), newLen(ast.NewIdent(`item`)))
+	switchBodyStmt := &ast.BlockStmt{
+		List: make([]ast.Stmt, 0, len(options)+2),
+	}
+	if help != nil {
+		switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
+			List: []ast.Expr{
+				&ast.BasicLit{
+					Kind:  token.CHAR,
+					Value: `'h'`,
+				},
+			},
+			Body: []ast.Stmt{help},
+		})
+	}
+	for _, item := range options {
+		var body []ast.Stmt
+		if item.isFlag() {
+			body = []ast.Stmt{
+				newDefine(optionValueName, newString(`true`)),
+				newIf(g.newCall(`strings`, `HasPrefix`, rest, newString(`=`)),
+					newAssign(ast.NewIdent(optionValueName), &ast.SliceExpr{
+						X:   ast.NewIdent(`item`),
+						Low: newBinary(ast.NewIdent(positionName), token.ADD, newInt(2)),
+					}),
+					stop,
+				),
+			}
+		} else {
+			body = []ast.Stmt{
+				newDefine(optionValueName, g.newCall(`strings`, `TrimPrefix`, rest, newString(`=`))),
+				newIf(newBinary(newLen(ast.NewIdent(optionValueName)), token.EQL, newInt(0)),
+					newIf(newBinary(newBinary(ast.NewIdent(indexName), token.ADD, newInt(1)), token.EQL, newLen(ast.NewIdent(`items`))),
+						g.newErrorReturn(`option '-%c' requires a value`, current),
+					),
+					&ast.IncDecStmt{
+						X:   ast.NewIdent(indexName),
+						Tok: token.INC,
+					},
+					newAssign(ast.NewIdent(optionValueName), &ast.IndexExpr{
+						X:     ast.NewIdent(`items`),
+						Index: ast.NewIdent(indexName),
+					}),
+				),
+				stop,
+			}
+		}
+		switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
+			List: []ast.Expr{
+				&ast.BasicLit{
+					Kind:  token.CHAR,
+					Value: fmt.Sprintf(`'%s'`, item.Short),
+				},
+			},
+			Body: append(append(body, g.generateSetVariable(item, ast.NewIdent(optionValueName))...), generateSetMark(item)...),
+		})
+	}
+	switchBodyStmt.List = append(switchBodyStmt.List, &ast.CaseClause{
+		Body: []ast.Stmt{
+			g.newErrorReturn(`wrong short option '%c' from '%s'`, current, ast.NewIdent(`item`)),
+		},
+	})
+
+	return &ast.IfStmt{
+		Cond: newBinary(
+			newBinary(newNot(ast.NewIdent(endOfOptionsName)), token.LAND, g.newCall(`strings`, `HasPrefix`, ast.NewIdent(`item`), newString(`-`))),
+			token.LAND,
+			newBinary(newLen(ast.NewIdent(`item`)), token.GTR, newInt(1)),
+		),
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ForStmt{
+					Init: newDefine(positionName, newInt(1)),
+					Cond: newBinary(ast.NewIdent(positionName), token.LSS, newLen(ast.NewIdent(`item`))),
+					Post: &ast.IncDecStmt{
+						X:   ast.NewIdent(positionName),
+						Tok: token.INC,
+					},
+					Body: &ast.BlockStmt{
+						List: []ast.Stmt{
+							&ast.SwitchStmt{
+								Tag:  current,
+								Body: switchBodyStmt,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (g *generator) generateSetVariable(item *Field, value ast.Expr) []ast.Stmt {
+	if item.Pointer {
+		return pointerVariable(g.generateFormatVariable(item, value))
+	}
+	if !item.Slice && !item.Map {
+		return g.generateFormatVariable(item, value)
+	}
+	if len(item.Separator) == 0 {
+		return g.generateCollectVariable(item, value)
+	}
+	return []ast.Stmt{
+		&ast.RangeStmt{
+			Key:   ast.NewIdent(`_`),
+			Value: ast.NewIdent(elementName),
+			Tok:   token.DEFINE,
+			X:     g.newCall(`strings`, `Split`, value, newString(item.Separator)),
+			Body: &ast.BlockStmt{
+				List: g.generateCollectVariable(item, ast.NewIdent(elementName)),
+			},
+		},
+	}
+}
+
+func (g *generator) generateCollectVariable(item *Field, value ast.Expr) []ast.Stmt {
+	if item.Slice {
+		return appendVariable(g.generateFormatVariable(item, value))
+	}
+	variable := newFieldSelector(item)
+	key := newIndex(pairName, 0)
+	body := []ast.Stmt{
+		newDefine(pairName, g.newCall(`strings`, `SplitN`, value, newString(`=`), newInt(2))),
+		newIf(newBinary(newLen(ast.NewIdent(pairName)), token.NEQ, newInt(2)),
+			g.newErrorReturn(`wrong value '%s' of '%s', expected key=value`, value, ast.NewIdent(`item`)),
+		),
+		newIf(newBinary(variable, token.EQL, ast.NewIdent(`nil`)),
+			newAssign(variable, &ast.CompositeLit{
+				Type: &ast.MapType{
+					Key:   ast.NewIdent(`string`),
+					Value: g.typeExpr(item),
+				},
+			}),
+		),
+	}
+	if !item.Overwrite {
+		body = append(body, &ast.IfStmt{
+			Init: &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(`_`), ast.NewIdent(`ok`)},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{&ast.IndexExpr{X: variable, Index: key}},
+			},
+			Cond: ast.NewIdent(`ok`),
+			Body: &ast.BlockStmt{
+				List: []ast.Stmt{
+					g.newErrorReturn(`duplicate key '%s' in '%s'`, key, ast.NewIdent(`item`)),
+				},
+			},
+		})
+	}
+	return append(body, indexVariable(g.generateFormatVariable(item, newIndex(pairName, 1)), key)...)
+}
+
+func indexVariable(body []ast.Stmt, key ast.Expr) []ast.Stmt {
+	assign := body[len(body)-1].(*ast.AssignStmt)
+	assign.Lhs[0] = &ast.IndexExpr{
+		X:     assign.Lhs[0],
+		Index: key,
+	}
+	return body
+}
+
+func negateVariable(item *Field) []ast.Stmt {
+	body := []ast.Stmt{
+		newAssign(newFieldSelector(item), ast.NewIdent(`false`)),
+	}
+	if item.Pointer {
+		return pointerVariable(body)
+	}
+	return body
+}
+
+func pointerVariable(body []ast.Stmt) []ast.Stmt {
+	assign := body[len(body)-1].(*ast.AssignStmt)
+	return append(body[:len(body)-1],
+		newDefine(pointerValueName, assign.Rhs[0]),
+		newAssign(assign.Lhs[0], &ast.UnaryExpr{
+			Op: token.AND,
+			X:  ast.NewIdent(pointerValueName),
+		}),
+	)
+}
+
+func appendVariable(body []ast.Stmt) []ast.Stmt {
+	assign := body[len(body)-1].(*ast.AssignStmt)
+	assign.Rhs[0] = &ast.CallExpr{
+		Fun:  ast.NewIdent(`append`),
+		Args: []ast.Expr{assign.Lhs[0], assign.Rhs[0]},
+	}
+	return body
+}
+
+func (g *generator) generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
 	var body []ast.Stmt
 	switch item.VariableType {
+	case VariableDelegated:
+		return g.generateDelegatedVariable(item, value)
+	case VariableDuration, VariableTime:
+		call := g.newCall(`time`, `ParseDuration`, value)
+		if item.VariableType == VariableTime {
+			call = g.newCall(`time`, `Parse`, g.layoutExpr(item), value)
+		}
+		body = []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{
+					ast.NewIdent(`value`),
+					ast.NewIdent(`err`),
+				},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{call},
+			},
+			newIf(newBinary(ast.NewIdent(`err`), token.NEQ, ast.NewIdent(`nil`)),
+				&ast.ReturnStmt{
+					Results: []ast.Expr{
+						ast.NewIdent(`nil`),
+						ast.NewIdent(`err`),
+					},
+				},
+			),
+			newAssign(newFieldSelector(item), ast.NewIdent(`value`)),
+		}
 	case VariableString:
 		body = make([]ast.Stmt, 1)
 		body[0] = &ast.AssignStmt{
 			Lhs: []ast.Expr{
-				&ast.SelectorExpr{
-					X:   ast.NewIdent(commandName),
-					Sel: ast.NewIdent(item.Name),
-				},
+				newFieldSelector(item),
 			},
 			Tok: token.ASSIGN,
 			Rhs: []ast.Expr{
@@ -394,7 +875,6 @@ func generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
 			},
 		}
 	default:
-		strconv = true
 		body = make([]ast.Stmt, 3)
 		strConvFunctionIdent := ast.NewIdent(``)
 		assingFuncNameIdent := ast.NewIdent(``)
@@ -407,7 +887,7 @@ func generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
 			Rhs: []ast.Expr{
 				&ast.CallExpr{
 					Fun: &ast.SelectorExpr{
-						X:   ast.NewIdent(`strconv`),
+						X:   g.use(`strconv`),
 						Sel: strConvFunctionIdent,
 					},
 					Args: []ast.Expr{
@@ -435,10 +915,7 @@ func generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
 		}
 		body[2] = &ast.AssignStmt{
 			Lhs: []ast.Expr{
-				&ast.SelectorExpr{
-					X:   ast.NewIdent(commandName),
-					Sel: ast.NewIdent(item.Name),
-				},
+				newFieldSelector(item),
 			},
 			Tok: token.ASSIGN,
 			Rhs: []ast.Expr{
@@ -551,9 +1028,221 @@ func generateFormatVariable(item *Field, value ast.Expr) []ast.Stmt {
 			}
 		}
 	}
+	last := body[len(body)-1].(*ast.AssignStmt)
+	if check := g.generateConstraintsCheck(item, value, last.Rhs[0]); len(check) > 0 {
+		body = append(append(body[:len(body)-1], check...), last)
+	}
+	if len(item.TypeName) > 0 {
+		args := []ast.Expr{last.Rhs[0]}
+		if call, ok := last.Rhs[0].(*ast.CallExpr); ok {
+			args = call.Args
+		}
+		last.Rhs[0] = &ast.CallExpr{
+			Fun:  g.typeExpr(item),
+			Args: args,
+		}
+	}
 	return body
 }
 
+func (g *generator) formatDefault(item *Field) (ast.Expr, error) {
+	if !item.Slice && !item.Map {
+		return g.formatDefaultValue(item, item.Default)
+	}
+	values := []string{item.Default}
+	if len(item.Separator) > 0 {
+		values = strings.Split(item.Default, item.Separator)
+	}
+	if item.Map {
+		list := &ast.CompositeLit{
+			Type: &ast.MapType{
+				Key:   ast.NewIdent(`string`),
+				Value: g.typeExpr(item),
+			},
+		}
+		keys := map[string]bool{}
+		for _, value := range values {
+			pair := strings.SplitN(value, `=`, 2)
+			if len(pair) != 2 {
+				return nil, fmt.Errorf(`expected key=value in '%s'`, value)
+			}
+			if keys[pair[0]] {
+				return nil, fmt.Errorf(`duplicate key '%s'`, pair[0])
+			}
+			keys[pair[0]] = true
+			element, err := g.formatDefaultValue(item, pair[1])
+			if err != nil {
+				return nil, err
+			}
+			list.Elts = append(list.Elts, &ast.KeyValueExpr{
+				Key:   newString(pair[0]),
+				Value: element,
+			})
+		}
+		return list, nil
+	}
+	list := &ast.CompositeLit{
+		Type: &ast.ArrayType{
+			Elt: g.typeExpr(item),
+		},
+	}
+	for _, value := range values {
+		element, err := g.formatDefaultValue(item, value)
+		if err != nil {
+			return nil, err
+		}
+		list.Elts = append(list.Elts, element)
+	}
+	return list, nil
+}
+
+func (g *generator) typeExpr(item *Field) ast.Expr {
+	if len(item.TypeName) > 0 {
+		if len(item.TypePackage) == 0 {
+			return ast.NewIdent(item.TypeName)
+		}
+		name := strings.SplitN(item.TypeName, `.`, 2)
+		return newSelector(g.useNamed(item.TypePackage, name[0]), name[1])
+	}
+	switch item.VariableType {
+	case VariableDuration:
+		return newSelector(g.use(`time`), `Duration`)
+	case VariableTime:
+		return newSelector(g.use(`time`), `Time`)
+	default:
+		return ast.NewIdent(item.VariableType.String())
+	}
+}
+
+func (g *generator) layoutExpr(item *Field) ast.Expr {
+	if len(item.Layout) == 0 {
+		return newSelector(g.use(`time`), `RFC3339`)
+	}
+	return newString(item.Layout)
+}
+
+// convertDefault converts a time.Duration or time.Time default to a named
+// type such as type Wait time.Duration.
+func (g *generator) convertDefault(item *Field, value ast.Expr) ast.Expr {
+	if len(item.TypeName) == 0 {
+		return value
+	}
+	return &ast.CallExpr{
+		Fun:  g.typeExpr(item),
+		Args: []ast.Expr{value},
+	}
+}
+
+func (g *generator) formatDefaultValue(item *Field, value string) (ast.Expr, error) {
+	variableType := item.VariableType
+	switch variableType {
+	case VariableDuration:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		return g.convertDefault(item, g.formatDuration(parsed)), nil
+	case VariableTime:
+		layout := item.Layout
+		if len(layout) == 0 {
+			layout = time.RFC3339
+		}
+		parsed, err := time.Parse(layout, value)
+		if err != nil {
+			return nil, err
+		}
+		return g.convertDefault(item, g.formatTime(parsed)), nil
+	case VariableString:
+		return newString(value), nil
+	case VariableBool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewIdent(strconv.FormatBool(parsed)), nil
+	case VariableInt, VariableInt8, VariableInt16, VariableInt32, VariableInt64:
+		parsed, err := strconv.ParseInt(value, 10, variableType.bitSize())
+		if err != nil {
+			return nil, err
+		}
+		return &ast.BasicLit{
+			Kind:  token.INT,
+			Value: strconv.FormatInt(parsed, 10),
+		}, nil
+	case VariableUint, VariableUint8, VariableUint16, VariableUint32, VariableUint64:
+		parsed, err := strconv.ParseUint(value, 10, variableType.bitSize())
+		if err != nil {
+			return nil, err
+		}
+		return &ast.BasicLit{
+			Kind:  token.INT,
+			Value: strconv.FormatUint(parsed, 10),
+		}, nil
+	case VariableFloat32, VariableFloat64:
+		parsed, err := strconv.ParseFloat(value, variableType.bitSize())
+		if err != nil {
+			return nil, err
+		}
+		return &ast.BasicLit{
+			Kind:  token.FLOAT,
+			Value: strconv.FormatFloat(parsed, 'g', -1, variableType.bitSize()),
+		}, nil
+	default:
+		return nil, fmt.Errorf(`default value isn't supported`)
+	}
+}
+
+func (g *generator) formatDuration(value time.Duration) ast.Expr {
+	units := []struct {
+		name string
+		unit time.Duration
+	}{
+		{`Hour`, time.Hour},
+		{`Minute`, time.Minute},
+		{`Second`, time.Second},
+		{`Millisecond`, time.Millisecond},
+		{`Microsecond`, time.Microsecond},
+	}
+	for _, item := range units {
+		if value != 0 && value%item.unit == 0 {
+			return newBinary(
+				&ast.BasicLit{
+					Kind:  token.INT,
+					Value: strconv.FormatInt(int64(value/item.unit), 10),
+				},
+				token.MUL,
+				newSelector(g.use(`time`), item.name),
+			)
+		}
+	}
+	return &ast.CallExpr{
+		Fun: newSelector(g.use(`time`), `Duration`),
+		Args: []ast.Expr{
+			&ast.BasicLit{
+				Kind:  token.INT,
+				Value: strconv.FormatInt(int64(value), 10),
+			},
+		},
+	}
+}
+
+func (g *generator) formatTime(value time.Time) ast.Expr {
+	var location ast.Expr = newSelector(g.use(`time`), `UTC`)
+	if name, offset := value.Zone(); offset != 0 || name != `UTC` {
+		location = g.newCall(`time`, `FixedZone`, newString(name), newInt(offset))
+	}
+	return g.newCall(`time`, `Date`,
+		newInt(value.Year()),
+		newSelector(g.use(`time`), value.Month().String()),
+		newInt(value.Day()),
+		newInt(value.Hour()),
+		newInt(value.Minute()),
+		newInt(value.Second()),
+		newInt(value.Nanosecond()),
+		location,
+	)
+}
+
 func formatLongOption(name string) string {
 	res := ``
 	for index, item := range reName.FindAllString(name, -1) {
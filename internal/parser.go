@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
-	"io"
+	"go/types"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -14,19 +15,49 @@ type (
 	VariableType int8
 	Field        struct {
 		Name         string
+		Long         string
 		Short        string
 		VariableType VariableType
 		Type         FieldType
 		Default      string
+		Separator    string
+		Layout       string
+		TypeName     string
+		TypePackage  string
+		Method       string
+		Embedded     []string
+		Choices      []string
+		Min          string
+		Max          string
+		Pattern      string
+		Env          string
+		Slice        bool
+		Map          bool
+		Pointer      bool
+		Overwrite    bool
+		Required     bool
+		Description  string
+		Pos          token.Pos
 	}
 	Fields  []*Field
 	Command struct {
-		Package, Name   string
-		FileSet *token.FileSet
-		Writer io.Writer
-		ShortOptions Fields
-		LongOptions Fields
-		Arguments Fields
+		Package, Name string
+		Title         string
+		Description   string
+		FileSet       *token.FileSet
+		Fields        Fields
+		ShortOptions  Fields
+		LongOptions   Fields
+		Arguments     Fields
+		Commands      Fields
+		Embedded      Fields
+		Run           bool
+		Handler       *Handler
+	}
+	Handler struct {
+		Name    string
+		Context bool
+		Pointer bool
 	}
 	Commands []*Command
 )
@@ -34,6 +65,8 @@ type (
 const (
 	FieldOption FieldType = iota + 1
 	FieldArgument
+	FieldCommand
+	FieldEmbedded
 )
 
 const (
@@ -51,13 +84,16 @@ const (
 	VariableFloat32
 	VariableFloat64
 	VariableBool
+	VariableDuration
+	VariableTime
+	VariableDelegated
 )
 
-func ParseCommands(packageName string, tt []*ast.TypeSpec) (Commands, error) {
+func ParseCommands(fileSet *token.FileSet, info *types.Info, packageName string, tt []*ast.TypeSpec) (Commands, error) {
 	var err error
 	commands := make(Commands, len(tt))
 	for i, t := range tt {
-		commands[i], err = ParseCommand(packageName, t)
+		commands[i], err = ParseCommand(fileSet, info, packageName, t)
 		if err != nil {
 			return nil, err
 		}
@@ -65,65 +101,173 @@ func ParseCommands(packageName string, tt []*ast.TypeSpec) (Commands, error) {
 	return commands, nil
 }
 
-func ParseCommand(packageName string, t *ast.TypeSpec) (*Command, error) {
+func ParseCommand(fileSet *token.FileSet, info *types.Info, packageName string, t *ast.TypeSpec) (*Command, error) {
 	st, ok := t.Type.(*ast.StructType)
 	if !ok {
 		return nil, fmt.Errorf(`wrong struct type for '%s'`, t.Name.Name)
 	}
 
 	c := Command{
-		Package: packageName,
-		Name:   t.Name.Name,
+		Package:      packageName,
+		Name:         t.Name.Name,
+		Title:        formatLongOption(t.Name.Name),
+		Description:  parseDescription(t.Doc, t.Comment),
+		FileSet:      fileSet,
+		Fields:       make(Fields, 0, st.Fields.NumFields()),
 		ShortOptions: make(Fields, 0, st.Fields.NumFields()),
-		LongOptions: make(Fields, 0, st.Fields.NumFields()),
-		Arguments: make(Fields, 0, st.Fields.NumFields()),
+		LongOptions:  make(Fields, 0, st.Fields.NumFields()),
+		Arguments:    make(Fields, 0, st.Fields.NumFields()),
 	}
 
+	var fields Fields
 	for _, field := range st.Fields.List {
-		f, err := parseField(field)
+		if isGroup(field) {
+			embedded, err := parseEmbedded(info, field, nil, ``)
+			if err != nil {
+				return nil, fmt.Errorf(`error of parsing %s:%s: %s`, t.Name.Name, fieldName(field), err)
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		f, err := parseField(info, field, FieldArgument)
 		if err != nil {
 			return nil, fmt.Errorf(`error of parsing %s:%s: %s`, t.Name.Name, field.Names[0].Name, err)
 		}
+		fields = append(fields, f)
+	}
+	for _, f := range fields {
+		if f.Type == FieldEmbedded {
+			c.Embedded = append(c.Embedded, f)
+			continue
+		}
+		c.Fields = append(c.Fields, f)
 		switch f.Type {
 		case FieldOption:
-			if len(f.Name) > 0 {
+			if len(f.Long) > 0 {
+				if c.hasLong(f.Long) {
+					return nil, fmt.Errorf(`error of parsing %s:%s: duplicate option '--%s'`, t.Name.Name, f.path(), f.Long)
+				}
 				c.LongOptions = append(c.LongOptions, f)
 			}
 
 			if len(f.Short) > 0 {
+				if c.hasShort(f.Short) {
+					return nil, fmt.Errorf(`error of parsing %s:%s: duplicate option '-%s'`, t.Name.Name, f.path(), f.Short)
+				}
 				c.ShortOptions = append(c.ShortOptions, f)
 			}
 		case FieldArgument:
+			if len(c.Arguments) > 0 && c.Arguments[len(c.Arguments)-1].Slice {
+				return nil, fmt.Errorf(`error of parsing %s:%s: argument after variadic one`, t.Name.Name, f.path())
+			}
+			if f.Required && len(c.Arguments) > 0 && !c.Arguments[len(c.Arguments)-1].Required {
+				return nil, fmt.Errorf(`error of parsing %s:%s: required argument after optional one`, t.Name.Name, f.path())
+			}
 			c.Arguments = append(c.Arguments, f)
+		case FieldCommand:
+			for _, item := range c.Commands {
+				if item.Long == f.Long {
+					return nil, fmt.Errorf(`error of parsing %s:%s: duplicate command '%s'`, t.Name.Name, f.path(), f.Long)
+				}
+			}
+			c.Commands = append(c.Commands, f)
 		}
 	}
+	if len(c.Commands) > 0 && len(c.Arguments) > 0 {
+		return nil, fmt.Errorf(`error of parsing %s: arguments can't be mixed with commands`, t.Name.Name)
+	}
 	return &c, nil
 
 }
 
-func parseField(field *ast.Field) (*Field, error) {
+// ParseDirective applies the arguments of a //coge:command directive.
+func (c *Command) ParseDirective(args map[string]string) error {
+	for key, value := range args {
+		switch key {
+		case `name`:
+			if len(value) == 0 {
+				return fmt.Errorf(`empty name of command '%s'`, c.Name)
+			}
+			c.Title = value
+		default:
+			return fmt.Errorf(`undefined argument '%s' of command '%s'`, key, c.Name)
+		}
+	}
+	return nil
+}
+
+func parseField(info *types.Info, field *ast.Field, fieldType FieldType) (*Field, error) {
 	if len(field.Names) > 1 {
 		return nil, fmt.Errorf(`multiple names for field`)
 	}
 	var err error
 	f := Field{
-		Name: field.Names[0].Name,
-		Type: FieldArgument,
-	}
-	f.VariableType, err = parseVariableType(field)
-	if err != nil {
-		return nil, fmt.Errorf(`error parsing variable type: %s`, err)
+		Name:        field.Names[0].Name,
+		Type:        fieldType,
+		Description: parseDescription(field.Doc, field.Comment),
+		Pos:         field.Pos(),
 	}
 	props, err := parseProps(field)
 	if err != nil {
 		return nil, err
 	}
+	if name, ok := props[`command`]; ok {
+		return parseCommandField(&f, field, name, len(props))
+	}
+	variableType := field.Type
+	if array, ok := variableType.(*ast.ArrayType); ok {
+		if array.Len != nil {
+			return nil, fmt.Errorf(`arrays aren't supported, use a slice`)
+		}
+		f.Slice = true
+		variableType = array.Elt
+	} else if mapType, ok := variableType.(*ast.MapType); ok {
+		if key, ok := mapType.Key.(*ast.Ident); !ok || key.Name != `string` {
+			return nil, fmt.Errorf(`only string keys are supported for maps`)
+		}
+		f.Map = true
+		variableType = mapType.Value
+	} else if star, ok := variableType.(*ast.StarExpr); ok {
+		f.Pointer = true
+		variableType = star.X
+	}
+	f.VariableType, err = parseVariableType(variableType)
+	if err != nil {
+		if delegatedErr := parseDelegated(info, &f, variableType); delegatedErr != nil {
+			if namedErr := parseNamed(info, &f, variableType); namedErr != nil {
+				return nil, fmt.Errorf(`error parsing variable type: %s: %s`, err, delegatedErr)
+			}
+		}
+	}
+	if f.Slice && f.VariableType == VariableBool {
+		return nil, fmt.Errorf(`slice of bool isn't supported`)
+	}
+	var required, optional bool
 	for key, value := range props {
 		switch key {
 		case `short`:
+			if len(value) != 1 || value[0] == '-' || value[0] == '=' {
+				return nil, fmt.Errorf(`short option '%s' must be a single character`, value)
+			}
 			f.Short = value
 		case `default`:
 			f.Default = value
+		case `separator`:
+			f.Separator = value
+		case `overwrite`:
+			f.Overwrite = true
+		case `layout`:
+			f.Layout = value
+		case `choices`:
+			f.Choices = strings.Split(value, `|`)
+		case `min`:
+			f.Min = value
+		case `max`:
+			f.Max = value
+		case `pattern`:
+			f.Pattern = value
+		case `env`:
+			f.Env = value
 		case `type`:
 			t, err := parseType(value)
 			if err != nil {
@@ -131,18 +275,222 @@ func parseField(field *ast.Field) (*Field, error) {
 			}
 			f.Type = t
 		case `name`:
-			f.Name = value
+			f.Long = value
+		case `required`:
+			required = true
+		case `optional`:
+			optional = true
 		default:
 			return nil, fmt.Errorf(`undefined property '%s' of tag`, key)
 		}
 	}
+	switch f.Type {
+	case FieldOption:
+		if optional {
+			return nil, fmt.Errorf(`property 'optional' is allowed only for arguments`)
+		}
+		if required && len(f.Default) > 0 {
+			return nil, fmt.Errorf(`required option can't have a default value`)
+		}
+		f.Required = required
+	case FieldArgument:
+		if required && optional {
+			return nil, fmt.Errorf(`argument can't be both required and optional`)
+		}
+		if len(f.Env) > 0 {
+			return nil, fmt.Errorf(`property 'env' is allowed only for options`)
+		}
+		f.Required = !optional && len(f.Default) == 0
+	}
+	if len(f.Separator) > 0 && !f.Slice && !f.Map {
+		return nil, fmt.Errorf(`property 'separator' is allowed only for slices and maps`)
+	}
+	if len(f.Layout) > 0 && f.VariableType != VariableTime {
+		return nil, fmt.Errorf(`property 'layout' is allowed only for time.Time`)
+	}
+	if f.Pointer && len(f.Default) > 0 {
+		return nil, fmt.Errorf(`default value isn't supported for pointers`)
+	}
+	if f.Overwrite && !f.Map {
+		return nil, fmt.Errorf(`property 'overwrite' is allowed only for maps`)
+	}
+	if f.Map && f.Type != FieldOption {
+		return nil, fmt.Errorf(`map is allowed only for options`)
+	}
+	if len(f.Long) == 0 {
+		f.Long = formatLongOption(f.Name)
+	}
+	if err := parseConstraints(&f); err != nil {
+		return nil, err
+	}
 	return &f, nil
 }
 
-func parseVariableType(field *ast.Field) (VariableType, error) {
-	switch field.Type.(type) {
+func (f *Field) path() string {
+	return strings.Join(append(f.Embedded[:len(f.Embedded):len(f.Embedded)], f.Name), `.`)
+}
+
+func (f *Field) displayName() string {
+	if f.Type == FieldOption {
+		return `--` + f.Long
+	}
+	return `<` + formatLongOption(f.Name) + `>`
+}
+
+func parseCommandField(f *Field, field *ast.Field, name string, props int) (*Field, error) {
+	if props > 1 {
+		return nil, fmt.Errorf(`property 'command' can't be combined with other properties`)
+	}
+	star, ok := field.Type.(*ast.StarExpr)
+	if !ok {
+		return nil, fmt.Errorf(`command must be a pointer to a struct type`)
+	}
+	ident, ok := star.X.(*ast.Ident)
+	if !ok {
+		return nil, fmt.Errorf(`command must be a pointer to a struct type of the same package`)
+	}
+	f.Type = FieldCommand
+	f.Pointer = true
+	f.TypeName = ident.Name
+	f.Long = name
+	if len(f.Long) == 0 {
+		f.Long = formatLongOption(f.Name)
+	}
+	return f, nil
+}
+
+// Linked returns names of subcommand types which aren't in the commands.
+func (c Commands) Linked() []string {
+	var names []string
+	for _, command := range c {
+		for _, item := range command.Commands {
+			if c.find(item.TypeName) == nil && !contains(names, item.TypeName) {
+				names = append(names, item.TypeName)
+			}
+		}
+	}
+	return names
+}
+
+func (c Commands) find(name string) *Command {
+	for _, command := range c {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+func contains(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Command) position(item *Field) string {
+	if c.FileSet == nil || !item.Pos.IsValid() {
+		return fmt.Sprintf(`%s.%s`, c.Name, item.path())
+	}
+	return fmt.Sprintf(`%s: %s.%s`, c.FileSet.Position(item.Pos), c.Name, item.path())
+}
+
+func (t VariableType) bitSize() int {
+	switch t {
+	case VariableInt8, VariableUint8:
+		return 8
+	case VariableInt16, VariableUint16:
+		return 16
+	case VariableInt32, VariableUint32, VariableFloat32:
+		return 32
+	default:
+		return 64
+	}
+}
+
+func (t VariableType) String() string {
+	switch t {
+	case VariableString:
+		return `string`
+	case VariableInt:
+		return `int`
+	case VariableInt8:
+		return `int8`
+	case VariableInt16:
+		return `int16`
+	case VariableInt32:
+		return `int32`
+	case VariableInt64:
+		return `int64`
+	case VariableUint:
+		return `uint`
+	case VariableUint8:
+		return `uint8`
+	case VariableUint16:
+		return `uint16`
+	case VariableUint32:
+		return `uint32`
+	case VariableUint64:
+		return `uint64`
+	case VariableFloat32:
+		return `float32`
+	case VariableFloat64:
+		return `float64`
+	case VariableBool:
+		return `bool`
+	case VariableDuration:
+		return `time.Duration`
+	case VariableTime:
+		return `time.Time`
+	case VariableDelegated:
+		return `value`
+	default:
+		return `unknown`
+	}
+}
+
+func (f *Field) typeName() string {
+	name := f.VariableType.String()
+	if f.VariableType == VariableDelegated {
+		name = f.TypeName
+	}
+	if f.Slice {
+		return `[]` + name
+	}
+	if f.Map {
+		return `map[string]` + name
+	}
+	return name
+}
+
+func (f *Field) isFlag() bool {
+	return f.VariableType == VariableBool && !f.Slice && !f.Map
+}
+
+func (c *Command) hasLong(name string) bool {
+	for _, item := range c.LongOptions {
+		if item.Long == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Command) hasShort(name string) bool {
+	for _, item := range c.ShortOptions {
+		if item.Short == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseVariableType(expr ast.Expr) (VariableType, error) {
+	switch expr.(type) {
 	case *ast.Ident:
-		v := field.Type.(*ast.Ident)
+		v := expr.(*ast.Ident)
 		switch v.Name {
 		case `string`:
 			return VariableString, nil
@@ -175,11 +523,124 @@ func parseVariableType(field *ast.Field) (VariableType, error) {
 		default:
 			return 0, fmt.Errorf(`undefined type: %s`, v.Name)
 		}
+	case *ast.SelectorExpr:
+		v := expr.(*ast.SelectorExpr)
+		if x, ok := v.X.(*ast.Ident); ok && x.Name == `time` {
+			switch v.Sel.Name {
+			case `Duration`:
+				return VariableDuration, nil
+			case `Time`:
+				return VariableTime, nil
+			}
+		}
+		return 0, fmt.Errorf(`undefined type: %s`, types.ExprString(expr))
 	default:
-		return 0, fmt.Errorf(`unknowed type %v`, field.Type)
+		return 0, fmt.Errorf(`unknowed type %s`, types.ExprString(expr))
 	}
 }
 
+// parseNamed resolves named types and aliases of the basic types,
+// time.Duration and time.Time through the type information.
+func parseNamed(info *types.Info, f *Field, expr ast.Expr) error {
+	if info == nil {
+		return fmt.Errorf(`type information isn't available`)
+	}
+	t := info.TypeOf(expr)
+	if t == nil {
+		return fmt.Errorf(`type can't be resolved`)
+	}
+	t = types.Unalias(t)
+	if f.VariableType = timeVariableType(info, t); f.VariableType == 0 {
+		basic, ok := t.Underlying().(*types.Basic)
+		if !ok {
+			return fmt.Errorf(`unsupported type %s`, t)
+		}
+		variableType, err := parseVariableType(ast.NewIdent(types.Typ[basic.Kind()].Name()))
+		if err != nil {
+			return err
+		}
+		f.VariableType = variableType
+	}
+	if named, ok := t.(*types.Named); ok && !isTimeType(named) {
+		f.TypeName = types.ExprString(expr)
+		f.TypePackage = typePackage(info, expr)
+	}
+	return nil
+}
+
+func isTimeType(named *types.Named) bool {
+	return named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == `time` &&
+		(named.Obj().Name() == `Duration` || named.Obj().Name() == `Time`)
+}
+
+// timeVariableType follows the declarations of t down to time.Duration or
+// time.Time, as the underlying type of type Wait time.Duration is int64.
+func timeVariableType(info *types.Info, t types.Type) VariableType {
+	for ; t != nil; t = declaredType(info, t) {
+		if named, ok := types.Unalias(t).(*types.Named); ok && isTimeType(named) {
+			if named.Obj().Name() == `Duration` {
+				return VariableDuration
+			}
+			return VariableTime
+		}
+	}
+	return 0
+}
+
+// declaredType returns the type a named type of the parsed package is
+// declared with, e.g. time.Duration for type Wait time.Duration, or nil.
+func declaredType(info *types.Info, t types.Type) types.Type {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return nil
+	}
+	var name *ast.Ident
+	for ident, object := range info.Defs {
+		if object == named.Obj() {
+			name = ident
+			break
+		}
+	}
+	if name == nil {
+		return nil
+	}
+	// the type expression follows the name of the type spec, so it's the
+	// outermost recorded expression starting first after the name
+	var declared ast.Expr
+	for item := range info.Types {
+		if item.Pos() <= name.End() {
+			continue
+		}
+		if declared == nil || item.Pos() < declared.Pos() || item.Pos() == declared.Pos() && item.End() > declared.End() {
+			declared = item
+		}
+	}
+	if declared == nil {
+		return nil
+	}
+	return info.Types[declared].Type
+}
+
+func typePackage(info *types.Info, expr ast.Expr) string {
+	if selector, ok := expr.(*ast.SelectorExpr); ok {
+		if x, ok := selector.X.(*ast.Ident); ok {
+			if name, ok := info.Uses[x].(*types.PkgName); ok {
+				return name.Imported().Path()
+			}
+		}
+	}
+	return ``
+}
+
+func parseDescription(groups ...*ast.CommentGroup) string {
+	for _, group := range groups {
+		if text := strings.TrimSpace(group.Text()); len(text) > 0 {
+			return text
+		}
+	}
+	return ``
+}
+
 func parseType(value string) (FieldType, error) {
 	switch value {
 	case `option`:
@@ -196,7 +657,11 @@ func parseProps(field *ast.Field) (map[string]string, error) {
 	if field.Tag != nil {
 		switch field.Tag.Kind {
 		case token.STRING:
-			cli, ok := reflect.StructTag(strings.Trim(field.Tag.Value, "`")).Lookup(`cli`)
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf(`wrong tag %s: %s`, field.Tag.Value, err)
+			}
+			cli, ok := reflect.StructTag(tag).Lookup(`cli`)
 			if ok {
 				var key string
 				var value string
@@ -204,7 +669,7 @@ func parseProps(field *ast.Field) (map[string]string, error) {
 				var initCollect bool
 				var border rune
 				for _, item := range cli {
-					if item == ':' {
+					if item == ':' && !isValue && border == 0 {
 						isValue = true
 						continue
 					}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+const missingErrorSource = `
+
+// MissingError is returned by the generated constructors when required
+// options or arguments are not given.
+type MissingError struct {
+	Items []string
+}
+
+func (e *MissingError) Error() string {
+	return "missing required " + strings.Join(e.Items, ", ")
+}
+`
+
+const missingName = `missing`
+
+func setMarkName(item *Field) string {
+	return `set` + strings.Replace(item.path(), `.`, ``, -1)
+}
+
+// hasSetMark reports whether the constructor tracks that the option is
+// given, to check required options and to let flags win over env.
+func hasSetMark(item *Field) bool {
+	return item.Type == FieldOption && (item.Required || len(item.Env) > 0)
+}
+
+func generateSetMark(item *Field) []ast.Stmt {
+	if !hasSetMark(item) {
+		return nil
+	}
+	return []ast.Stmt{
+		newAssign(ast.NewIdent(setMarkName(item)), ast.NewIdent(`true`)),
+	}
+}
+
+func (g *generator) generateRequiredCheck(command *Command) []ast.Stmt {
+	var check []ast.Stmt
+	appendMissing := func(cond ast.Expr, name string) {
+		check = append(check, newIf(cond,
+			newAssign(ast.NewIdent(missingName), &ast.CallExpr{
+				Fun:  ast.NewIdent(`append`),
+				Args: []ast.Expr{ast.NewIdent(missingName), newString(name)},
+			}),
+		))
+	}
+	for _, item := range command.Fields {
+		if item.Type == FieldOption && item.Required {
+			appendMissing(newNot(ast.NewIdent(setMarkName(item))), item.displayName())
+		}
+	}
+	for index, item := range command.Arguments {
+		if item.Required && item.Slice {
+			appendMissing(
+				newBinary(newLen(newFieldSelector(item)), token.EQL, newInt(0)),
+				item.displayName(),
+			)
+		} else if item.Required {
+			appendMissing(
+				newBinary(ast.NewIdent(argumentCountName), token.GEQ, newInt(len(command.Arguments)-index)),
+				item.displayName(),
+			)
+		}
+	}
+	if len(check) == 0 {
+		return nil
+	}
+	g.missingError = true
+
+	return append([]ast.Stmt{
+		&ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: token.VAR,
+				Specs: []ast.Spec{
+					&ast.ValueSpec{
+						Names: []*ast.Ident{ast.NewIdent(missingName)},
+						Type:  &ast.ArrayType{Elt: ast.NewIdent(`string`)},
+					},
+				},
+			},
+		},
+	}, append(check, newIf(newBinary(newLen(ast.NewIdent(missingName)), token.GTR, newInt(0)),
+		&ast.ReturnStmt{
+			Results: []ast.Expr{
+				ast.NewIdent(`nil`),
+				&ast.UnaryExpr{
+					Op: token.AND,
+					X: &ast.CompositeLit{
+						Type: ast.NewIdent(missingErrorName),
+						Elts: []ast.Expr{
+							&ast.KeyValueExpr{
+								Key:   ast.NewIdent(`Items`),
+								Value: ast.NewIdent(missingName),
+							},
+						},
+					},
+				},
+			},
+		},
+	))...)
+}
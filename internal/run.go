@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"log"
+	"strings"
+)
+
+const mainSource = `
+
+// Main parses args without the program name, runs the chosen command and
+// returns the exit code: 0 on success or help, 2 on wrong usage, 1 or the
+// ExitCode() of the error returned by Run or the handler.
+func Main(args []string) int {
+	command, err := New%s(args...)
+	if errors.Is(err, ErrHelp) {
+		fmt.Fprint(os.Stdout, err)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+%s	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		var exit interface{ ExitCode() int }
+		if errors.As(err, &exit) {
+			return exit.ExitCode()
+		}
+		return 1
+	}
+	return 0
+}
+`
+
+// ParseMethods marks the command as runnable when methods contain
+// Run(ctx context.Context) error.
+func (c *Command) ParseMethods(info *types.Info, methods []*ast.FuncDecl) error {
+	for _, method := range methods {
+		if method.Name.Name != `Run` {
+			continue
+		}
+		params, results := method.Type.Params.List, method.Type.Results
+		if len(params) != 1 || len(params[0].Names) > 1 || !isContext(info, params[0].Type) ||
+			results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 || !isError(info, results.List[0].Type) {
+			return fmt.Errorf(`method %s.Run must be func(ctx context.Context) error`, c.Name)
+		}
+		c.Run = true
+	}
+	return nil
+}
+
+const handlerDirective = `//coge:handler`
+
+// ParseHandlers registers functions marked with //coge:handler as handlers
+// of the commands they take, e.g. func Serve(opts ServeOptions) error.
+// The options may be passed by pointer and preceded by a context.Context.
+func (c Commands) ParseHandlers(fileSet *token.FileSet, info *types.Info, functions []*ast.FuncDecl) error {
+	for _, function := range functions {
+		if !hasDirective(function.Doc, handlerDirective) {
+			continue
+		}
+		handler, name, err := parseHandler(info, function)
+		if err != nil {
+			return fmt.Errorf(`%s: %s`, fileSet.Position(function.Pos()), err)
+		}
+		command := c.find(name)
+		if command == nil {
+			continue
+		}
+		if command.Run || command.Handler != nil {
+			return fmt.Errorf(`%s: command '%s' already has a handler`, fileSet.Position(function.Pos()), name)
+		}
+		command.Handler = handler
+	}
+	return nil
+}
+
+func parseHandler(info *types.Info, function *ast.FuncDecl) (*Handler, string, error) {
+	handler := Handler{
+		Name: function.Name.Name,
+	}
+	var params []ast.Expr
+	for _, param := range function.Type.Params.List {
+		params = append(params, param.Type)
+		for index := 1; index < len(param.Names); index++ {
+			params = append(params, param.Type)
+		}
+	}
+	results := function.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 || !isError(info, results.List[0].Type) {
+		return nil, ``, fmt.Errorf(`handler %s must return error`, handler.Name)
+	}
+	if len(params) == 2 && isContext(info, params[0]) {
+		handler.Context = true
+		params = params[1:]
+	}
+	if len(params) != 1 {
+		return nil, ``, fmt.Errorf(`handler %s must take the command options`, handler.Name)
+	}
+	param := params[0]
+	if star, ok := param.(*ast.StarExpr); ok {
+		handler.Pointer = true
+		param = star.X
+	}
+	ident, ok := param.(*ast.Ident)
+	if !ok {
+		return nil, ``, fmt.Errorf(`handler %s must take a command type of the same package`, handler.Name)
+	}
+	return &handler, ident.Name, nil
+}
+
+// isContext reports whether expr resolves to context.Context, whatever name
+// the context package is imported with.
+func isContext(info *types.Info, expr ast.Expr) bool {
+	t := info.TypeOf(expr)
+	if t == nil {
+		return false
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == `context` && named.Obj().Name() == `Context`
+}
+
+func isError(info *types.Info, expr ast.Expr) bool {
+	t := info.TypeOf(expr)
+	return t != nil && types.Identical(t, types.Universe.Lookup(`error`).Type())
+}
+
+func hasDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.TrimSpace(comment.Text) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) generateMain(commands Commands) string {
+	var roots []string
+	var root *Command
+	for _, command := range commands {
+		if !commands.linked(command.Name) && commands.runnable(command, map[string]bool{}) {
+			roots = append(roots, command.Name)
+			root = command
+		}
+	}
+	if len(roots) > 1 {
+		log.Printf(`Main isn't generated, it can run only one of the commands %s`, strings.Join(roots, `, `))
+		return ``
+	}
+	if root == nil {
+		return ``
+	}
+	for _, path := range []string{`context`, `errors`, `fmt`, `os`, `os/signal`} {
+		g.use(path)
+	}
+	dispatch := &bytes.Buffer{}
+	if len(root.Commands) == 0 {
+		_, _ = fmt.Fprintf(dispatch, "\terr = %s\n", formatRun(root, `command`))
+		return fmt.Sprintf(mainSource, strings.Title(root.Name), dispatch.String())
+	}
+	dispatch.WriteString("\tswitch command.Subcommand() {\n")
+	var walk func(command *Command, path []string, expr string, visited map[string]bool)
+	walk = func(command *Command, path []string, expr string, visited map[string]bool) {
+		_, _ = fmt.Fprintf(dispatch, "\tcase %s:\n", newString(strings.Join(path, ` `)).Value)
+		if command.Run || command.Handler != nil {
+			_, _ = fmt.Fprintf(dispatch, "\t\terr = %s\n", formatRun(command, expr))
+		} else {
+			_, _ = fmt.Fprintf(dispatch, "\t\tfmt.Fprint(os.Stderr, %s.Usage())\n\t\treturn 2\n", expr)
+		}
+		visited[command.Name] = true
+		for _, item := range command.Commands {
+			if child := commands.find(item.TypeName); child != nil && !visited[child.Name] {
+				walk(child, append(path[:len(path):len(path)], item.Long), expr+`.`+item.path(), visited)
+			}
+		}
+		delete(visited, command.Name)
+	}
+	walk(root, nil, `command`, map[string]bool{})
+	dispatch.WriteString("\t}\n")
+	return fmt.Sprintf(mainSource, strings.Title(root.Name), dispatch.String())
+}
+
+func formatRun(command *Command, expr string) string {
+	if command.Handler == nil {
+		return expr + `.Run(ctx)`
+	}
+	if !command.Handler.Pointer {
+		expr = `*` + expr
+	}
+	if command.Handler.Context {
+		expr = `ctx, ` + expr
+	}
+	return command.Handler.Name + `(` + expr + `)`
+}
+
+func (c Commands) linked(name string) bool {
+	for _, command := range c {
+		for _, item := range command.Commands {
+			if item.TypeName == name && command.Name != name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c Commands) runnable(command *Command, visited map[string]bool) bool {
+	if command.Run || command.Handler != nil {
+		return true
+	}
+	visited[command.Name] = true
+	for _, item := range command.Commands {
+		if child := c.find(item.TypeName); child != nil && !visited[child.Name] && c.runnable(child, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+const subcommandName = `subcommand`
+
+func (g *generator) generateCommandSwitch(command *Command) *ast.BlockStmt {
+	body := &ast.BlockStmt{}
+	for _, item := range command.Commands {
+		body.List = append(body.List, &ast.CaseClause{
+			List: []ast.Expr{newString(item.Long)},
+			Body: []ast.Stmt{
+				&ast.AssignStmt{
+					Lhs: []ast.Expr{ast.NewIdent(subcommandName), ast.NewIdent(`err`)},
+					Tok: token.DEFINE,
+					Rhs: []ast.Expr{
+						&ast.CallExpr{
+							Fun: ast.NewIdent(`New` + strings.Title(item.TypeName)),
+							Args: []ast.Expr{
+								&ast.SliceExpr{
+									X:   ast.NewIdent(`items`),
+									Low: newBinary(ast.NewIdent(indexName), token.ADD, newInt(1)),
+								},
+							},
+							Ellipsis: 1,
+						},
+					},
+				},
+				newIf(newBinary(ast.NewIdent(`err`), token.NEQ, ast.NewIdent(`nil`)),
+					&ast.ReturnStmt{
+						Results: []ast.Expr{ast.NewIdent(`nil`), ast.NewIdent(`err`)},
+					},
+				),
+				newAssign(newFieldSelector(item), ast.NewIdent(subcommandName)),
+				newAssign(ast.NewIdent(indexName), newLen(ast.NewIdent(`items`))),
+			},
+		})
+	}
+	body.List = append(body.List, &ast.CaseClause{
+		Body: []ast.Stmt{
+			g.newErrorReturn(`wrong command '%s'`, ast.NewIdent(`item`)),
+		},
+	})
+	return &ast.BlockStmt{
+		List: []ast.Stmt{
+			&ast.SwitchStmt{
+				Tag:  ast.NewIdent(`item`),
+				Body: body,
+			},
+		},
+	}
+}
+
+// generateSubcommand emits the Subcommand method which returns the chosen
+// path of subcommands separated by spaces, e.g. "db migrate".
+func (g *generator) generateSubcommand(command *Command, commands Commands) *ast.FuncDecl {
+	body := &ast.BlockStmt{}
+	for _, item := range command.Commands {
+		field := newFieldSelector(item)
+		var result ast.Expr = newString(item.Long)
+		if len(commands.find(item.TypeName).Commands) > 0 {
+			result = g.newCall(`strings`, `TrimSpace`, newBinary(
+				newString(item.Long+` `),
+				token.ADD,
+				&ast.CallExpr{Fun: newSelector(field, `Subcommand`)},
+			))
+		}
+		body.List = append(body.List, newIf(
+			newBinary(field, token.NEQ, ast.NewIdent(`nil`)),
+			&ast.ReturnStmt{Results: []ast.Expr{result}},
+		))
+	}
+	body.List = append(body.List, &ast.ReturnStmt{Results: []ast.Expr{newString(``)}})
+	return &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Names: []*ast.Ident{ast.NewIdent(commandName)},
+					Type:  &ast.StarExpr{X: ast.NewIdent(command.Name)},
+				},
+			},
+		},
+		Name: ast.NewIdent(`Subcommand`),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{Type: ast.NewIdent(`string`)},
+				},
+			},
+		},
+		Body: body,
+	}
+}
+
+// setTitles titles the subcommands with the path typed to reach them from
+// their root command, e.g. "tool db".
+func (c Commands) setTitles() {
+	var walk func(command *Command, visited map[string]bool)
+	walk = func(command *Command, visited map[string]bool) {
+		visited[command.Name] = true
+		for _, item := range command.Commands {
+			if child := c.find(item.TypeName); child != nil && !visited[child.Name] {
+				child.Title = command.Title + ` ` + item.Long
+				walk(child, visited)
+			}
+		}
+	}
+	visited := map[string]bool{}
+	for _, command := range c {
+		if !c.linked(command.Name) {
+			walk(command, visited)
+		}
+	}
+}
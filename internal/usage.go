@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"strings"
+	"text/tabwriter"
+)
+
+const helpErrorSource = `
+
+// ErrHelp is matched by HelpError when -h or --help was requested.
+var ErrHelp = errors.New("help requested")
+
+// HelpError is returned by the generated constructors for -h and --help
+// and carries the usage text of the command.
+type HelpError struct {
+	Usage string
+}
+
+func (e *HelpError) Error() string {
+	return e.Usage
+}
+
+func (e *HelpError) Is(target error) bool {
+	return target == ErrHelp
+}
+`
+
+func (g *generator) generateUsage(command *Command) *ast.FuncDecl {
+	return &ast.FuncDecl{
+		Recv: &ast.FieldList{
+			List: []*ast.Field{
+				{
+					Type: &ast.StarExpr{
+						X: ast.NewIdent(command.Name),
+					},
+				},
+			},
+		},
+		Name: ast.NewIdent(`Usage`),
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{
+				List: []*ast.Field{
+					{
+						Type: ast.NewIdent(`string`),
+					},
+				},
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ReturnStmt{
+					Results: []ast.Expr{
+						newString(formatUsage(command)),
+					},
+				},
+			},
+		},
+	}
+}
+
+func formatUsage(command *Command) string {
+	buffer := &bytes.Buffer{}
+	buffer.WriteString(`Usage: ` + command.Title + ` [options]`)
+	for _, item := range command.Arguments {
+		name := `<` + formatLongOption(item.Name) + `>`
+		if item.Slice {
+			name += `...`
+		}
+		if item.Required {
+			buffer.WriteString(` ` + name)
+		} else {
+			buffer.WriteString(` [` + name + `]`)
+		}
+	}
+	if len(command.Commands) > 0 {
+		buffer.WriteString(` [<command>]`)
+	}
+	if len(command.Description) > 0 {
+		buffer.WriteString("\n\n" + command.Description)
+	}
+	buffer.WriteString("\n\nOptions:\n")
+	writer := tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+	for _, item := range command.Fields {
+		if item.Type != FieldOption {
+			continue
+		}
+		_, _ = fmt.Fprintf(writer, "  %s\t%s\n", formatOptionNames(item), formatOptionDescription(item))
+	}
+	help := make([]string, 0, 2)
+	if !command.hasShort(`h`) {
+		help = append(help, `-h`)
+	}
+	if !command.hasLong(`help`) {
+		help = append(help, `--help`)
+	}
+	if len(help) > 0 {
+		_, _ = fmt.Fprintf(writer, "  %s\t%s\n", strings.Join(help, `, `), `show this help`)
+	}
+	_ = writer.Flush()
+	if len(command.Arguments) > 0 {
+		buffer.WriteString("\nArguments:\n")
+		writer = tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+		for _, item := range command.Arguments {
+			_, _ = fmt.Fprintf(writer, "  %s %s\t%s\n", formatLongOption(item.Name), item.typeName(), formatOptionDescription(item))
+		}
+		_ = writer.Flush()
+	}
+	if len(command.Commands) > 0 {
+		buffer.WriteString("\nCommands:\n")
+		writer = tabwriter.NewWriter(buffer, 0, 4, 2, ' ', 0)
+		for _, item := range command.Commands {
+			_, _ = fmt.Fprintf(writer, "  %s\t%s\n", item.Long, strings.Join(strings.Fields(item.Description), ` `))
+		}
+		_ = writer.Flush()
+	}
+	lines := strings.Split(buffer.String(), "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight(line, ` `)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatOptionNames(item *Field) string {
+	names := make([]string, 0, 2)
+	if len(item.Short) > 0 {
+		names = append(names, `-`+item.Short)
+	}
+	if len(item.Long) > 0 {
+		if item.isFlag() {
+			names = append(names, `--[no-]`+item.Long)
+		} else {
+			names = append(names, `--`+item.Long)
+		}
+	}
+	if item.isFlag() {
+		return strings.Join(names, `, `)
+	}
+	return strings.Join(names, `, `) + ` ` + item.typeName()
+}
+
+func formatOptionDescription(item *Field) string {
+	description := strings.Join(strings.Fields(item.Description), ` `)
+	if item.Type == FieldOption && item.Required {
+		description = strings.TrimSpace(description + ` (required)`)
+	}
+	if len(item.Choices) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (one of: %s)`, description, strings.Join(item.Choices, `, `)))
+	}
+	if len(item.Min) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (min %s)`, description, item.Min))
+	}
+	if len(item.Max) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (max %s)`, description, item.Max))
+	}
+	if len(item.Pattern) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (pattern %s)`, description, item.Pattern))
+	}
+	if len(item.Default) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (default %s)`, description, item.Default))
+	}
+	if len(item.Env) > 0 {
+		description = strings.TrimSpace(fmt.Sprintf(`%s (env %s)`, description, item.Env))
+	}
+	if item.Type == FieldOption && (item.Slice || item.Map) {
+		description = strings.TrimSpace(description + ` (repeatable)`)
+	}
+	return description
+}
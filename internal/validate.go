@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const validationErrorSource = `
+
+// ValidationError is returned by the generated constructors when a value
+// doesn't satisfy the choices, min, max or pattern of its option or argument.
+type ValidationError struct {
+	Name   string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "wrong value '" + e.Value + "' for " + e.Name + ": " + e.Reason
+}
+`
+
+func parseConstraints(f *Field) error {
+	numeric := f.isInteger() || f.VariableType == VariableFloat32 || f.VariableType == VariableFloat64
+	if len(f.Choices) > 0 && f.VariableType != VariableString && !f.isInteger() {
+		return fmt.Errorf(`property 'choices' is allowed only for strings and integers`)
+	}
+	if (len(f.Min) > 0 || len(f.Max) > 0) && !numeric {
+		return fmt.Errorf(`properties 'min' and 'max' are allowed only for numbers`)
+	}
+	if len(f.Pattern) > 0 {
+		if f.VariableType != VariableString {
+			return fmt.Errorf(`property 'pattern' is allowed only for strings`)
+		}
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf(`wrong pattern '%s': %s`, f.Pattern, err)
+		}
+	}
+	var err error
+	for index, choice := range f.Choices {
+		if f.Choices[index], err = f.formatNumber(choice); err != nil {
+			return fmt.Errorf(`wrong choice '%s': %s`, choice, err)
+		}
+	}
+	if f.Min, err = f.formatNumber(f.Min); err != nil {
+		return fmt.Errorf(`wrong min '%s': %s`, f.Min, err)
+	}
+	if f.Max, err = f.formatNumber(f.Max); err != nil {
+		return fmt.Errorf(`wrong max '%s': %s`, f.Max, err)
+	}
+	if len(f.Min) > 0 && len(f.Max) > 0 && f.compareNumbers(f.Min, f.Max) > 0 {
+		return fmt.Errorf(`min %s is greater than max %s`, f.Min, f.Max)
+	}
+	if len(f.Default) == 0 {
+		return nil
+	}
+	values := []string{f.Default}
+	if len(f.Separator) > 0 {
+		values = strings.Split(f.Default, f.Separator)
+	}
+	for _, value := range values {
+		if f.Map {
+			value = value[strings.Index(value, `=`)+1:]
+		}
+		if reason := f.checkValue(value); len(reason) > 0 {
+			return fmt.Errorf(`default value '%s' %s`, value, reason)
+		}
+	}
+	return nil
+}
+
+func (f *Field) isInteger() bool {
+	return f.VariableType >= VariableInt && f.VariableType <= VariableUint64
+}
+
+func (f *Field) formatNumber(value string) (string, error) {
+	if len(value) == 0 || f.VariableType == VariableString {
+		return value, nil
+	}
+	switch f.VariableType {
+	case VariableInt, VariableInt8, VariableInt16, VariableInt32, VariableInt64:
+		parsed, err := strconv.ParseInt(value, 10, f.VariableType.bitSize())
+		return strconv.FormatInt(parsed, 10), err
+	case VariableUint, VariableUint8, VariableUint16, VariableUint32, VariableUint64:
+		parsed, err := strconv.ParseUint(value, 10, f.VariableType.bitSize())
+		return strconv.FormatUint(parsed, 10), err
+	default:
+		parsed, err := strconv.ParseFloat(value, f.VariableType.bitSize())
+		return strconv.FormatFloat(parsed, 'g', -1, f.VariableType.bitSize()), err
+	}
+}
+
+func (f *Field) compareNumbers(a, b string) int {
+	switch f.VariableType {
+	case VariableInt, VariableInt8, VariableInt16, VariableInt32, VariableInt64:
+		x, _ := strconv.ParseInt(a, 10, 64)
+		y, _ := strconv.ParseInt(b, 10, 64)
+		return compare(x < y, x > y)
+	case VariableUint, VariableUint8, VariableUint16, VariableUint32, VariableUint64:
+		x, _ := strconv.ParseUint(a, 10, 64)
+		y, _ := strconv.ParseUint(b, 10, 64)
+		return compare(x < y, x > y)
+	default:
+		x, _ := strconv.ParseFloat(a, 64)
+		y, _ := strconv.ParseFloat(b, 64)
+		return compare(x < y, x > y)
+	}
+}
+
+func compare(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+// checkValue returns the reason why value breaks the constraints of the field
+// or an empty string, the value must be already valid for the field type.
+func (f *Field) checkValue(value string) string {
+	if len(f.Choices) > 0 {
+		formatted, _ := f.formatNumber(value)
+		if !f.hasChoice(formatted) {
+			return f.choicesReason()
+		}
+	}
+	if len(f.Min) > 0 && f.compareNumbers(value, f.Min) < 0 {
+		return `must be at least ` + f.Min
+	}
+	if len(f.Max) > 0 && f.compareNumbers(value, f.Max) > 0 {
+		return `must be at most ` + f.Max
+	}
+	if len(f.Pattern) > 0 && !regexp.MustCompile(f.Pattern).MatchString(value) {
+		return `must match ` + f.Pattern
+	}
+	return ``
+}
+
+func (f *Field) hasChoice(value string) bool {
+	for _, choice := range f.Choices {
+		if choice == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Field) choicesReason() string {
+	return `expected one of: ` + strings.Join(f.Choices, `, `)
+}
+
+func (g *generator) generateConstraintsCheck(item *Field, raw, value ast.Expr) []ast.Stmt {
+	var check []ast.Stmt
+	if len(item.Choices) > 0 {
+		var cond ast.Expr
+		for _, choice := range item.Choices {
+			next := newBinary(value, token.NEQ, g.formatConstraint(item, choice))
+			if cond == nil {
+				cond = next
+			} else {
+				cond = newBinary(cond, token.LAND, next)
+			}
+		}
+		check = append(check, newIf(cond, g.newValidationReturn(item, raw, item.choicesReason())))
+	}
+	if len(item.Min) > 0 {
+		check = append(check, newIf(
+			newBinary(value, token.LSS, g.formatConstraint(item, item.Min)),
+			g.newValidationReturn(item, raw, `must be at least `+item.Min),
+		))
+	}
+	if len(item.Max) > 0 {
+		check = append(check, newIf(
+			newBinary(value, token.GTR, g.formatConstraint(item, item.Max)),
+			g.newValidationReturn(item, raw, `must be at most `+item.Max),
+		))
+	}
+	if len(item.Pattern) > 0 {
+		match := &ast.CallExpr{
+			Fun:  newSelector(g.newCall(`regexp`, `MustCompile`, newString(item.Pattern)), `MatchString`),
+			Args: []ast.Expr{value},
+		}
+		check = append(check, newIf(newNot(match), g.newValidationReturn(item, raw, `must match `+item.Pattern)))
+	}
+	return check
+}
+
+func (g *generator) formatConstraint(item *Field, value string) ast.Expr {
+	if item.VariableType == VariableString {
+		return newString(value)
+	}
+	kind := token.INT
+	if !item.isInteger() {
+		kind = token.FLOAT
+	}
+	return &ast.BasicLit{
+		Kind:  kind,
+		Value: value,
+	}
+}
+
+func (g *generator) newValidationReturn(item *Field, raw ast.Expr, reason string) *ast.ReturnStmt {
+	g.validationError = true
+	return &ast.ReturnStmt{
+		Results: []ast.Expr{
+			ast.NewIdent(`nil`),
+			&ast.UnaryExpr{
+				Op: token.AND,
+				X: &ast.CompositeLit{
+					Type: ast.NewIdent(validationErrorName),
+					Elts: []ast.Expr{
+						&ast.KeyValueExpr{Key: ast.NewIdent(`Name`), Value: newString(item.displayName())},
+						&ast.KeyValueExpr{Key: ast.NewIdent(`Value`), Value: raw},
+						&ast.KeyValueExpr{Key: ast.NewIdent(`Reason`), Value: newString(reason)},
+					},
+				},
+			},
+		},
+	}
+}